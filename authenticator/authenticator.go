@@ -32,7 +32,7 @@ func New() (*Authenticator, error) {
 		backendUrl = os.Getenv("BACKEND_DEV_URL")
 	}
 
-	auth0CallbackUrl := backendUrl + "/api/v1/auth/callback"
+	auth0CallbackUrl := backendUrl + "/api/v1/auth/oidc/callback"
 
 	conf := oauth2.Config{
 		ClientID:     os.Getenv("AUTH0_CLIENT_ID"),
@@ -6,13 +6,29 @@ type ImageWidthHeight struct {
 	Large  int64 `bson:"large" json:"large"`
 }
 
+type ImageUrls struct {
+	Small  string `bson:"small" json:"small"`
+	Medium string `bson:"medium" json:"medium"`
+	Large  string `bson:"large" json:"large"`
+}
+
+// CoverVariants are the links of a processed cover in each size and format.
+type CoverVariants struct {
+	Jpeg ImageUrls `bson:"jpeg" json:"jpeg"`
+	Webp ImageUrls `bson:"webp" json:"webp"`
+}
+
 type CoverImage struct {
 	PublicId string           `bson:"publicId" json:"publicId"`
 	Url      string           `bson:"url" json:"url"`
 	Width    ImageWidthHeight `bson:"width" json:"width"`
 	Height   ImageWidthHeight `bson:"height" json:"height"`
+	Variants *CoverVariants   `bson:"variants,omitempty" json:"variants,omitempty"`
 }
 
+// Covers are cropped to the aspect of these sizes and scaled down to them. The real
+// dimensions of processed covers are stored on the book, these are only reported for
+// covers that were never processed.
 var defaultWidth = ImageWidthHeight{Small: 65, Medium: 130, Large: 260}
 var defaultHeight = ImageWidthHeight{Small: 95, Medium: 190, Large: 380}
 
@@ -0,0 +1,357 @@
+package admin
+
+import (
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/auditlogs"
+	"example/aibooks-backend/models/bookassets"
+	"example/aibooks-backend/models/bookdeletions"
+	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/models/staticdatas"
+	"example/aibooks-backend/serializers"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// bookRequest is the full set of catalog fields, used to create or replace a book.
+type bookRequest struct {
+	Title              string   `json:"title" binding:"required,max=200"`
+	Slug               string   `json:"slug" binding:"omitempty,max=100"`
+	Summary            string   `json:"summary" binding:"required,max=5000"`
+	Genre              []string `json:"genre" binding:"required,min=1,max=10,dive,required,max=50"`
+	TotalChapters      int      `json:"totalChapters" binding:"required,min=1,max=1000"`
+	PdfUrl             string   `json:"pdfUrl" binding:"omitempty,url"`
+	PdfPublicId        string   `json:"pdfPublicId" binding:"max=200"`
+	CoverImageUrl      string   `json:"coverImageUrl" binding:"omitempty,url"`
+	CoverImagePublicId string   `json:"coverImagePublicId" binding:"max=200"`
+}
+
+// bookPatchRequest is bookRequest with every field optional.
+type bookPatchRequest struct {
+	Title              *string   `json:"title" binding:"omitempty,min=1,max=200"`
+	Slug               *string   `json:"slug" binding:"omitempty,min=1,max=100"`
+	Summary            *string   `json:"summary" binding:"omitempty,min=1,max=5000"`
+	Genre              *[]string `json:"genre" binding:"omitempty,min=1,max=10,dive,required,max=50"`
+	TotalChapters      *int      `json:"totalChapters" binding:"omitempty,min=1,max=1000"`
+	PdfUrl             *string   `json:"pdfUrl" binding:"omitempty,url"`
+	PdfPublicId        *string   `json:"pdfPublicId" binding:"omitempty,max=200"`
+	CoverImageUrl      *string   `json:"coverImageUrl" binding:"omitempty,url"`
+	CoverImagePublicId *string   `json:"coverImagePublicId" binding:"omitempty,max=200"`
+}
+
+func auditBookChange(c *gin.Context, action string, bookId primitive.ObjectID, details bson.M) {
+	actorId, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	err := auditlogs.AddAuditLog(auditlogs.AuditLog{
+		ActorId:    actorId,
+		Action:     action,
+		TargetType: "book",
+		TargetId:   bookId,
+		Ip:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Details:    details,
+	})
+	if err != nil {
+		log.Println("Failed to write audit log", action, "for book", bookId.Hex(), err)
+	}
+}
+
+// validateGenres checks genres against the genre list in static data. It responds
+// itself and returns false when a genre is unknown.
+func validateGenres(c *gin.Context, genres []string) bool {
+	validGenres, err := staticdatas.GetGenres()
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return false
+	}
+
+	for _, genre := range genres {
+		if !slices.Contains(validGenres, genre) {
+			c.IndentedJSON(400, gin.H{"message": "Invalid genre: " + genre})
+			return false
+		}
+	}
+	return true
+}
+
+// respondBookWriteError maps the errors CreateBook and UpdateBook return.
+func respondBookWriteError(c *gin.Context, err error) {
+	apiErr, ok := err.(errorHandling.APIError)
+	switch {
+	case ok && apiErr.Status == 404:
+		c.IndentedJSON(404, gin.H{"message": "Book not found."})
+	case ok && apiErr.Status == 409:
+		c.IndentedJSON(409, gin.H{"message": "A book with this slug already exists."})
+	case ok && apiErr.Status == 400:
+		c.IndentedJSON(400, gin.H{"message": "Slugs may only contain lowercase letters, digits and single hyphens."})
+	default:
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+	}
+}
+
+func CreateBook(c *gin.Context) {
+	var data bookRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+	if !validateGenres(c, data.Genre) {
+		return
+	}
+
+	book, err := books.CreateBook(books.BookData{
+		Title:              data.Title,
+		Slug:               data.Slug,
+		Summary:            data.Summary,
+		Genre:              data.Genre,
+		TotalChapters:      data.TotalChapters,
+		PdfUrl:             data.PdfUrl,
+		PdfPublicId:        data.PdfPublicId,
+		CoverImageUrl:      data.CoverImageUrl,
+		CoverImagePublicId: data.CoverImagePublicId,
+	})
+	if err != nil {
+		respondBookWriteError(c, err)
+		return
+	}
+
+	auditBookChange(c, "book.created", book.Id, bson.M{"title": book.Title, "slug": book.Slug})
+
+	c.IndentedJSON(201, serializers.NewAdminBook(book))
+}
+
+// ReplaceBook overwrites every catalog field. An omitted slug is derived from the title again.
+func ReplaceBook(c *gin.Context) {
+	var data bookRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	if !validateGenres(c, data.Genre) {
+		return
+	}
+
+	if data.Slug == "" {
+		// An invalid id leaves the slug empty, UpdateBook rejects the id first
+		if bookId, err := primitive.ObjectIDFromHex(c.Param("id")); err == nil {
+			data.Slug = books.DefaultSlug(data.Title, bookId)
+		}
+	}
+
+	book, err := books.UpdateBook(c.Param("id"), books.BookUpdate{
+		Title:              &data.Title,
+		Slug:               &data.Slug,
+		Summary:            &data.Summary,
+		Genre:              &data.Genre,
+		TotalChapters:      &data.TotalChapters,
+		PdfUrl:             &data.PdfUrl,
+		PdfPublicId:        &data.PdfPublicId,
+		CoverImageUrl:      &data.CoverImageUrl,
+		CoverImagePublicId: &data.CoverImagePublicId,
+	})
+	if err != nil {
+		respondBookWriteError(c, err)
+		return
+	}
+
+	auditBookChange(c, "book.updated", book.Id, bson.M{"replaced": true})
+
+	c.IndentedJSON(200, serializers.NewAdminBook(book))
+}
+
+func PatchBook(c *gin.Context) {
+	var data bookPatchRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+	if data.Genre != nil && !validateGenres(c, *data.Genre) {
+		return
+	}
+
+	update := books.BookUpdate{
+		Title:              data.Title,
+		Slug:               data.Slug,
+		Summary:            data.Summary,
+		Genre:              data.Genre,
+		TotalChapters:      data.TotalChapters,
+		PdfUrl:             data.PdfUrl,
+		PdfPublicId:        data.PdfPublicId,
+		CoverImageUrl:      data.CoverImageUrl,
+		CoverImagePublicId: data.CoverImagePublicId,
+	}
+
+	fields := []string{}
+	for name, set := range map[string]bool{
+		"title":              data.Title != nil,
+		"slug":               data.Slug != nil,
+		"summary":            data.Summary != nil,
+		"genre":              data.Genre != nil,
+		"totalChapters":      data.TotalChapters != nil,
+		"pdfUrl":             data.PdfUrl != nil,
+		"pdfPublicId":        data.PdfPublicId != nil,
+		"coverImageUrl":      data.CoverImageUrl != nil,
+		"coverImagePublicId": data.CoverImagePublicId != nil,
+	} {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+	slices.Sort(fields)
+	if len(fields) == 0 {
+		c.IndentedJSON(400, gin.H{"message": "Nothing to update."})
+		return
+	}
+
+	book, err := books.UpdateBook(c.Param("id"), update)
+	if err != nil {
+		respondBookWriteError(c, err)
+		return
+	}
+
+	auditBookChange(c, "book.updated", book.Id, bson.M{"fields": fields})
+
+	c.IndentedJSON(200, serializers.NewAdminBook(book))
+}
+
+// DeleteBook removes the book, its ratings and every library entry for it.
+func DeleteBook(c *gin.Context) {
+	book, err := books.GetBookById(c.Param("id"))
+	if apiErr, ok := err.(errorHandling.APIError); ok && (apiErr.Status == 404 || apiErr.Status == 400) {
+		c.IndentedJSON(404, gin.H{"message": "Book not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	err = bookdeletions.DeleteBook(book)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Book not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	auditBookChange(c, "book.deleted", book.Id, bson.M{
+		"title":        book.Title,
+		"slug":         book.Slug,
+		"totalRatings": book.TotalRatings,
+	})
+
+	c.IndentedJSON(200, gin.H{"message": "Book deleted."})
+}
+
+// readUpload reads the multipart file in field, rejecting anything over maxSize. It
+// responds itself and returns false when the upload is unusable.
+func readUpload(c *gin.Context, field string, maxSize int64, tooLarge string) ([]byte, bool) {
+	// Leave some room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+
+	fileHeader, err := c.FormFile(field)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Missing " + field + "."})
+		return nil, false
+	}
+	if fileHeader.Size > maxSize {
+		c.IndentedJSON(413, gin.H{"message": tooLarge})
+		return nil, false
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return nil, false
+	}
+	return data, true
+}
+
+func getBookForUpload(c *gin.Context) (books.BookData, bool) {
+	book, err := books.GetBookById(c.Param("id"))
+	if apiErr, ok := err.(errorHandling.APIError); ok && (apiErr.Status == 404 || apiErr.Status == 400) {
+		c.IndentedJSON(404, gin.H{"message": "Book not found."})
+		return book, false
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return book, false
+	}
+	return book, true
+}
+
+func UploadBookPdf(c *gin.Context) {
+	book, ok := getBookForUpload(c)
+	if !ok {
+		return
+	}
+
+	data, ok := readUpload(c, "pdf", bookassets.MaxPdfSize, "PDF must be at most 50 MB.")
+	if !ok {
+		return
+	}
+
+	book, err := bookassets.SavePdf(book, data)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 413 {
+		c.IndentedJSON(413, gin.H{"message": "PDF must be at most 50 MB."})
+		return
+	} else if ok && apiErr.Status == 415 {
+		c.IndentedJSON(415, gin.H{"message": "File must be a PDF."})
+		return
+	} else if ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Book not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	auditBookChange(c, "book.pdf_uploaded", book.Id, bson.M{"key": book.PdfPublicId, "size": len(data)})
+
+	c.IndentedJSON(200, serializers.NewAdminBook(book))
+}
+
+func UploadBookCover(c *gin.Context) {
+	book, ok := getBookForUpload(c)
+	if !ok {
+		return
+	}
+
+	data, ok := readUpload(c, "cover", bookassets.MaxCoverSize, "Cover must be at most 5 MB.")
+	if !ok {
+		return
+	}
+
+	book, err := bookassets.SaveCover(book, data)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 413 {
+		c.IndentedJSON(413, gin.H{"message": "Cover must be at most 5 MB."})
+		return
+	} else if ok && apiErr.Status == 415 {
+		c.IndentedJSON(415, gin.H{"message": "Cover must be a JPEG, PNG or WebP image."})
+		return
+	} else if ok && apiErr.Status == 422 {
+		c.IndentedJSON(422, gin.H{"message": "Cover must be at most 8000 pixels wide and high."})
+		return
+	} else if ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Book not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	auditBookChange(c, "book.cover_uploaded", book.Id, bson.M{"key": book.CoverImagePublicId, "size": len(data)})
+
+	c.IndentedJSON(200, serializers.NewAdminBook(book))
+}
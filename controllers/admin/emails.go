@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/emailoutbox"
+	"example/aibooks-backend/serializers"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetEmails lists outbox messages, optionally filtered by ?status= and ?to=.
+func GetEmails(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	limit = min(max(limit, 1), 100)
+	page = max(page, 1)
+
+	messages, err := emailoutbox.GetOutboxMessages(c.Query("status"), c.Query("to"), page, limit)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, serializers.NewOutboxEmails(messages))
+}
+
+func GetEmail(c *gin.Context) {
+	id := c.Param("id")
+
+	message, err := emailoutbox.GetOutboxMessageById(id)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Email not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, serializers.NewOutboxEmail(message))
+}
+
+func RetryEmail(c *gin.Context) {
+	id := c.Param("id")
+
+	err := emailoutbox.RetryMessage(id)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Dead-lettered email not found."})
+		return
+	} else if ok && apiErr.Status == 409 {
+		c.IndentedJSON(409, gin.H{"message": "This email can't be retried, it was queued without its template data."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Email queued for retry."})
+}
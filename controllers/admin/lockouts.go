@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/loginattempts"
+	"example/aibooks-backend/serializers"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetLockouts(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	limit = min(max(limit, 1), 100)
+	page = max(page, 1)
+
+	lockouts, err := loginattempts.GetActiveLockouts(page, limit)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, serializers.NewLockouts(lockouts))
+}
+
+func ClearLockout(c *gin.Context) {
+	id := c.Param("id")
+
+	err := loginattempts.ClearLockout(id)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Lockout not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Lockout cleared."})
+}
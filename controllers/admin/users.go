@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/auditlogs"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/serializers"
+	"log"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func GetUser(c *gin.Context) {
+	user, err := users.GetUserById(c.Param("id"))
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "User not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, serializers.NewAdminUser(user))
+}
+
+func UpdateUserRoles(c *gin.Context) {
+	var data struct {
+		Roles []string `json:"roles" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	for _, role := range data.Roles {
+		if !slices.Contains(users.ValidRoles, role) {
+			c.IndentedJSON(400, gin.H{"message": "Invalid role: " + role})
+			return
+		}
+	}
+
+	userId := c.Param("id")
+	err := users.UpdateRoles(userId, data.Roles)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "User not found."})
+		return
+	} else if ok && apiErr.Status == 409 {
+		c.IndentedJSON(409, gin.H{"message": "At least one admin must remain."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	actorId, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	targetId, _ := primitive.ObjectIDFromHex(userId)
+	err = auditlogs.AddAuditLog(auditlogs.AuditLog{
+		ActorId:    actorId,
+		Action:     "user.roles_updated",
+		TargetType: "user",
+		TargetId:   targetId,
+		Ip:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Details:    bson.M{"roles": data.Roles},
+	})
+	if err != nil {
+		// The roles already changed, so the request still succeeds
+		log.Println("Failed to write audit log for role update of", userId, err)
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Roles updated."})
+}
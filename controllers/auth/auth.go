@@ -1,19 +1,35 @@
 package auth
 
 import (
+	"example/aibooks-backend/serializers"
 	"fmt"
-	"os"
+	"math"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 
 	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/keyring"
+	"example/aibooks-backend/models/loginattempts"
 	"example/aibooks-backend/models/otps"
+	"example/aibooks-backend/models/refreshtokens"
 	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/models/usersessions"
 	"example/aibooks-backend/utils"
 )
 
+var dummyPasswordHash = func() string {
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return string(hash)
+}()
+
 func CreateAccount(c *gin.Context) {
 	var data struct {
 		FirstName       string `json:"first_name" binding:"required"`
@@ -29,8 +45,9 @@ func CreateAccount(c *gin.Context) {
 		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
 		return
 	}
+	data.Email = users.NormalizeEmail(data.Email)
 
-	if !otps.CompareOtp(data.Email, data.Otp) {
+	if !otps.ConsumeOtp(data.Email, data.Otp, otps.PurposeSignup) {
 		c.IndentedJSON(400, gin.H{"message": "Invalid OTP"})
 		return
 	}
@@ -48,13 +65,19 @@ func CreateAccount(c *gin.Context) {
 		Password:      string(bcryptPassword),
 		EmailVerified: true,
 	}
-	userId, err := users.AddUser(user)
-	if err != nil {
+	user.Id, err = users.AddUser(user)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 409 {
+		c.IndentedJSON(409, gin.H{"message": "An account with this email already exists. Use forgot password to recover it."})
+		return
+	} else if err != nil {
 		c.IndentedJSON(400, gin.H{"message": "Failed to create account"})
 		return
 	}
 
-	createJWTTokenCookie(c, userId.Hex())
+	if err := createAuthCookies(c, user); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Failed to generate token"})
+		return
+	}
 	c.IndentedJSON(201, gin.H{"message": "Account created successfully"})
 }
 
@@ -68,43 +91,104 @@ func Login(c *gin.Context) {
 		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
 		return
 	}
+	data.Email = users.NormalizeEmail(data.Email)
 
-	existingUser, err := users.GetUserByEmail(data.Email)
+	lockedUntil, err := loginattempts.GetLockedUntil(data.Email, c.ClientIP())
 	if err != nil {
-		c.IndentedJSON(404, gin.H{"message": "User not found."})
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
 		return
 	}
-
-	err = bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(data.Password))
-	if err != nil {
-		c.IndentedJSON(400, gin.H{"message": "Invalid credentials."})
+	if !lockedUntil.IsZero() {
+		RespondLockedOut(c, lockedUntil)
 		return
 	}
 
-	createJWTTokenCookie(c, existingUser.Id.Hex())
-	c.IndentedJSON(200, gin.H{
-		"message": "Success",
-	})
-}
-
-func createJWTTokenCookie(c *gin.Context, userId string) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userId,
-	})
+	// Unknown users still pay for a bcrypt comparison and get the same response as a
+	// wrong password, so neither timing nor message reveals whether the account exists
+	existingUser, err := users.GetUserByEmail(data.Email)
+	if apiErr, ok := err.(errorHandling.APIError); err != nil && !(ok && apiErr.Status == 404) {
+		// Only an unknown user is a bad credential, a database error must not count towards a lockout
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	passwordHash := utils.Ternary(err == nil && existingUser.Password != "", existingUser.Password, dummyPasswordHash)
+	compareErr := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(data.Password))
+	if err != nil || compareErr != nil || passwordHash == dummyPasswordHash {
+		if err := loginattempts.RecordFailure(data.Email, c.ClientIP()); err != nil {
+			c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+		c.IndentedJSON(401, gin.H{"message": "Invalid email or password."})
+		return
+	}
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	mfaRequired, err := completeLogin(c, existingUser)
 	if err != nil {
 		c.IndentedJSON(400, gin.H{"message": "Failed to generate token"})
 		return
 	}
+	if mfaRequired {
+		// The failure counter is only reset once the second factor passes too
+		c.IndentedJSON(200, gin.H{
+			"message":     "Two-factor authentication required",
+			"mfaRequired": true,
+		})
+		return
+	}
 
-	secure := os.Getenv("ENV") == "PROD"
+	if err := loginattempts.RecordSuccess(data.Email); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	c.IndentedJSON(200, gin.H{
+		"message": "Success",
+	})
+}
 
-	c.Header("Set-Cookie", fmt.Sprintf("auth-token=%s; SameSite=None; Secure=%v; Path=/", tokenString, secure))
+func RespondLockedOut(c *gin.Context, lockedUntil time.Time) {
+	retryAfter := int(math.Ceil(time.Until(lockedUntil).Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.IndentedJSON(429, gin.H{"message": "Too many failed attempts, please try again later.", "retryAfter": retryAfter})
 }
 
+// Logout is reachable without a valid access token, so a session whose access token
+// already expired can still be ended. The refresh token cookie identifies the session,
+// a still valid access token is used when there is none.
 func Logout(c *gin.Context) {
-	c.Header("Set-Cookie", fmt.Sprintf("auth-token=%s; SameSite=None; Secure=%v; Path=/", "", false))
+	var userId, sessionId string
+	if raw, err := c.Cookie("refresh-token"); err == nil && raw != "" {
+		if token, err := refreshtokens.GetRefreshToken(raw); err == nil {
+			userId, sessionId = token.UserId.Hex(), token.FamilyId.Hex()
+		}
+	}
+	if sessionId == "" {
+		if tokenString, err := c.Cookie("auth-token"); err == nil && tokenString != "" {
+			if token, err := keyring.Parse(tokenString); err == nil {
+				if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims["purpose"] == nil {
+					userId, _ = claims["user_id"].(string)
+					sessionId, _ = claims["sid"].(string)
+				}
+			}
+		}
+	}
+
+	if sessionId != "" {
+		// An unknown or malformed session has nothing left to revoke
+		err := usersessions.RevokeSession(sessionId, userId)
+		if apiErr, ok := err.(errorHandling.APIError); err != nil && !(ok && (apiErr.Status == 404 || apiErr.Status == 400)) {
+			c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+
+		if sessionIdObj, err := primitive.ObjectIDFromHex(sessionId); err == nil {
+			if err := refreshtokens.RevokeFamily(sessionIdObj); err != nil {
+				c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+				return
+			}
+		}
+	}
+
+	ClearAuthCookies(c)
 	c.IndentedJSON(200, gin.H{"message": "Successfully logged out"})
 }
 
@@ -114,9 +198,10 @@ func GetUserDetails(c *gin.Context) {
 	user, err := users.GetUserById(userId)
 	if err != nil {
 		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
 	}
 
-	c.IndentedJSON(200, user)
+	c.IndentedJSON(200, serializers.NewSelfUser(user))
 }
 
 func SendOtp(c *gin.Context) {
@@ -128,8 +213,9 @@ func SendOtp(c *gin.Context) {
 		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
 		return
 	}
+	data.Email = users.NormalizeEmail(data.Email)
 
-	otp, err := otps.GenerateAndSaveOtpFor(data.Email)
+	otp, err := otps.GenerateAndSaveOtpFor(data.Email, otps.PurposeSignup)
 	if err == errorHandling.ErrTooSoon {
 		c.IndentedJSON(400, gin.H{"message": "Too soon, please try again later."})
 		return
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/keyring"
+	"example/aibooks-backend/models/otps"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/utils"
+)
+
+// createMagicLinkToken signs the email and nonce so the link can't be forged or
+// pointed at another account. The nonce itself is stored hashed in otps.
+func createMagicLinkToken(email string, nonce string) (string, error) {
+	now := time.Now()
+	return keyring.Sign(jwt.MapClaims{
+		"email":   email,
+		"nonce":   nonce,
+		"purpose": otps.PurposeMagicLink,
+		"iat":     now.Unix(),
+		"exp":     now.Add(otps.MagicLinkTTL).Unix(),
+	})
+}
+
+func parseMagicLinkToken(tokenString string) (string, string, error) {
+	token, err := keyring.Parse(tokenString)
+	if err != nil {
+		return "", "", err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != otps.PurposeMagicLink || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return "", "", errors.New("invalid magic link token")
+	}
+
+	email, _ := claims["email"].(string)
+	nonce, _ := claims["nonce"].(string)
+	if email == "" || nonce == "" {
+		return "", "", errors.New("invalid magic link token")
+	}
+	return email, nonce, nil
+}
+
+func SendMagicLink(c *gin.Context) {
+	var data struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	data.Email = users.NormalizeEmail(data.Email)
+
+	successMessage := gin.H{"message": "If an account exists for this email, a sign in link has been sent."}
+
+	if _, err := users.GetUserByEmail(data.Email); err != nil {
+		c.IndentedJSON(200, successMessage)
+		return
+	}
+
+	nonce, err := otps.GenerateAndSaveMagicLinkNonceFor(data.Email)
+	if err == errorHandling.ErrTooSoon {
+		// A rate limit only ever applies to existing accounts, so it must look like success too
+		c.IndentedJSON(200, successMessage)
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong generating link."})
+		return
+	}
+
+	token, err := createMagicLinkToken(data.Email, nonce)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong generating link."})
+		return
+	}
+
+	// The frontend page posts the token to /auth/magic/verify, so link scanners that
+	// prefetch URLs in emails can't use it up
+	link := getFrontendUrl() + "/auth/magic?token=" + url.QueryEscape(token)
+	if err := utils.SendMagicLinkEmail(data.Email, link); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong sending link."})
+		return
+	}
+
+	c.IndentedJSON(200, successMessage)
+}
+
+func VerifyMagicLink(c *gin.Context) {
+	var data struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	email, nonce, err := parseMagicLinkToken(data.Token)
+	if err != nil || !otps.ConsumeOtp(email, nonce, otps.PurposeMagicLink) {
+		c.IndentedJSON(401, gin.H{"message": "This sign in link is invalid or has expired."})
+		return
+	}
+
+	user, err := users.GetUserByEmail(email)
+	if err != nil {
+		c.IndentedJSON(401, gin.H{"message": "This sign in link is invalid or has expired."})
+		return
+	}
+
+	mfaRequired, err := completeLogin(c, user)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Failed to generate token"})
+		return
+	}
+	if mfaRequired {
+		c.IndentedJSON(200, gin.H{
+			"message":     "Two-factor authentication required",
+			"mfaRequired": true,
+		})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Success"})
+}
@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+
+	"example/aibooks-backend/keyring"
+	"example/aibooks-backend/models/loginattempts"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/utils"
+)
+
+var MfaTokenTTL = 5 * time.Minute
+
+const recoveryCodeCount = 10
+
+func getMfaIssuer() string {
+	return utils.Ternary(os.Getenv("MFA_ISSUER") != "", os.Getenv("MFA_ISSUER"), "AIBooks")
+}
+
+// createMfaTokenCookie marks the password step of a login as done. It is only accepted by VerifyMfa.
+func createMfaTokenCookie(c *gin.Context, userId string) error {
+	now := time.Now()
+	tokenString, err := keyring.Sign(jwt.MapClaims{
+		"user_id": userId,
+		"purpose": "mfa",
+		"iat":     now.Unix(),
+		"exp":     now.Add(MfaTokenTTL).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	setCookie(c, "mfa-token", tokenString, "/api/v1/auth/mfa", int(MfaTokenTTL.Seconds()), true)
+	return nil
+}
+
+func parseMfaToken(tokenString string) (string, error) {
+	token, err := keyring.Parse(tokenString)
+	if err != nil {
+		return "", err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != "mfa" || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return "", errors.New("invalid mfa token")
+	}
+
+	userId, ok := claims["user_id"].(string)
+	if !ok {
+		return "", errors.New("invalid mfa token")
+	}
+	return userId, nil
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		secret, err := utils.GenerateTotpSecret()
+		if err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(secret[:5] + "-" + secret[5:10])
+		codes[i] = code
+		hashes[i] = utils.HashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code.
+func verifySecondFactor(user users.Users, code string, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := utils.ValidateTotp(user.TotpSecret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return users.UseTotpStep(user.Id, step)
+	}
+
+	if recoveryCode != "" {
+		return users.UseRecoveryCode(user.Id, utils.HashToken(strings.ToLower(strings.TrimSpace(recoveryCode))))
+	}
+
+	return false, nil
+}
+
+func EnrollMfa(c *gin.Context) {
+	user, err := users.GetUserById(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if user.TotpEnabled {
+		c.IndentedJSON(409, gin.H{"message": "Two-factor authentication is already enabled."})
+		return
+	}
+
+	secret, err := utils.GenerateTotpSecret()
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if err := users.SetPendingTotpSecret(user.Id, secret); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{
+		"secret":     secret,
+		"otpauthUri": utils.TotpUri(getMfaIssuer(), user.Email, secret),
+	})
+}
+
+func ConfirmMfa(c *gin.Context) {
+	var data struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	user, err := users.GetUserById(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if user.TotpPendingSecret == "" {
+		c.IndentedJSON(400, gin.H{"message": "Start enrollment first."})
+		return
+	}
+
+	step, ok := utils.ValidateTotp(user.TotpPendingSecret, data.Code, time.Now())
+	if !ok {
+		c.IndentedJSON(400, gin.H{"message": "Invalid code"})
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if err := users.EnableTotp(user.Id, step, hashes); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	// Recovery codes are only stored hashed, this is the only time they are shown
+	c.IndentedJSON(200, gin.H{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+func DisableMfa(c *gin.Context) {
+	var data struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	user, err := users.GetUserById(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if !user.TotpEnabled {
+		c.IndentedJSON(400, gin.H{"message": "Two-factor authentication is not enabled."})
+		return
+	}
+
+	ok, err := verifySecondFactor(user, data.Code, data.RecoveryCode)
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	if !ok {
+		c.IndentedJSON(400, gin.H{"message": "Invalid code"})
+		return
+	}
+
+	if err := users.DisableTotp(user.Id); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func VerifyMfa(c *gin.Context) {
+	var data struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	tokenString, err := c.Cookie("mfa-token")
+	if err != nil || tokenString == "" {
+		c.IndentedJSON(401, gin.H{"message": "Login session expired, please log in again."})
+		return
+	}
+
+	userId, err := parseMfaToken(tokenString)
+	if err != nil {
+		c.IndentedJSON(401, gin.H{"message": "Login session expired, please log in again."})
+		return
+	}
+
+	user, err := users.GetUserById(userId)
+	if err != nil {
+		c.IndentedJSON(401, gin.H{"message": "Login session expired, please log in again."})
+		return
+	}
+
+	// Second factor guesses share the login lockout so they can't be brute forced either
+	lockedUntil, err := loginattempts.GetLockedUntil(user.Email, c.ClientIP())
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	if !lockedUntil.IsZero() {
+		RespondLockedOut(c, lockedUntil)
+		return
+	}
+
+	ok, err := verifySecondFactor(user, data.Code, data.RecoveryCode)
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	if !ok {
+		if err := loginattempts.RecordFailure(user.Email, c.ClientIP()); err != nil {
+			c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+		c.IndentedJSON(401, gin.H{"message": "Invalid code"})
+		return
+	}
+
+	if err := loginattempts.RecordSuccess(user.Email); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	setCookie(c, "mfa-token", "", "/api/v1/auth/mfa", -1, true)
+	if err := createAuthCookies(c, user); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Failed to generate token"})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Success"})
+}
+
+// completeLogin issues the full auth cookies, or only an mfa token when the user has 2FA enabled.
+func completeLogin(c *gin.Context, user users.Users) (bool, error) {
+	if user.TotpEnabled {
+		return true, createMfaTokenCookie(c, user.Id.Hex())
+	}
+	return false, createAuthCookies(c, user)
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"os"
+	"sync"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+
+	"example/aibooks-backend/authenticator"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/utils"
+)
+
+var oidcAuthenticator *authenticator.Authenticator
+var oidcAuthenticatorMu sync.Mutex
+
+// getAuthenticator creates the authenticator on first use. A failed discovery is not
+// cached, so a provider that was briefly unreachable is retried on the next request.
+func getAuthenticator() (*authenticator.Authenticator, error) {
+	oidcAuthenticatorMu.Lock()
+	defer oidcAuthenticatorMu.Unlock()
+
+	if oidcAuthenticator != nil {
+		return oidcAuthenticator, nil
+	}
+
+	a, err := authenticator.New()
+	if err != nil {
+		return nil, err
+	}
+	oidcAuthenticator = a
+	return oidcAuthenticator, nil
+}
+
+func getFrontendUrl() string {
+	return utils.Ternary(os.Getenv("ENV") == "PROD", os.Getenv("FRONTEND_PROD_URL"), os.Getenv("FRONTEND_DEV_URL"))
+}
+
+func OidcLogin(c *gin.Context) {
+	oidcAuth, err := getAuthenticator()
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	session := sessions.Default(c)
+	session.Set("state", state)
+	session.Set("verifier", verifier)
+	if err := session.Save(); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.Redirect(307, oidcAuth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)))
+}
+
+func OidcCallback(c *gin.Context) {
+	oidcAuth, err := getAuthenticator()
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	session := sessions.Default(c)
+	state, _ := session.Get("state").(string)
+	verifier, _ := session.Get("verifier").(string)
+
+	// state and verifier are single use
+	session.Delete("state")
+	session.Delete("verifier")
+	if err := session.Save(); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if state == "" || verifier == "" || c.Query("state") != state {
+		c.IndentedJSON(400, gin.H{"message": "Invalid state parameter."})
+		return
+	}
+
+	token, err := oidcAuth.Exchange(c.Request.Context(), c.Query("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		c.IndentedJSON(401, gin.H{"message": "Failed to exchange authorization code."})
+		return
+	}
+
+	idToken, err := oidcAuth.VerifyIDToken(c.Request.Context(), token)
+	if err != nil {
+		c.IndentedJSON(401, gin.H{"message": "Failed to verify ID token."})
+		return
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		c.IndentedJSON(401, gin.H{"message": "Failed to verify ID token."})
+		return
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		c.IndentedJSON(403, gin.H{"message": "Email not verified."})
+		return
+	}
+
+	user, err := users.GetUserByEmail(claims.Email)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		user = users.Users{
+			FirstName:     utils.Ternary(claims.GivenName != "", claims.GivenName, claims.Name),
+			LastName:      claims.FamilyName,
+			Email:         claims.Email,
+			EmailVerified: true,
+		}
+		user.Id, err = users.AddUser(user)
+	}
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	mfaRequired, err := completeLogin(c, user)
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Failed to generate token"})
+		return
+	}
+	if mfaRequired {
+		c.Redirect(307, getFrontendUrl()+"?mfaRequired=true")
+		return
+	}
+	c.Redirect(307, getFrontendUrl())
+}
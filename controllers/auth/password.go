@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/auditlogs"
+	"example/aibooks-backend/models/otps"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/utils"
+)
+
+func ForgotPassword(c *gin.Context) {
+	var data struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	data.Email = users.NormalizeEmail(data.Email)
+
+	// Same response whether or not the account exists, so this can't be used to probe emails
+	successMessage := gin.H{"message": "If an account exists for this email, an OTP has been sent."}
+
+	if _, err := users.GetUserByEmail(data.Email); err != nil {
+		c.IndentedJSON(200, successMessage)
+		return
+	}
+
+	otp, err := otps.GenerateAndSaveOtpFor(data.Email, otps.PurposePasswordReset)
+	if err == errorHandling.ErrTooSoon {
+		// A rate limit only ever applies to existing accounts, so it must look like success too
+		c.IndentedJSON(200, successMessage)
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong generating OTP."})
+		return
+	}
+
+	err = utils.SendPasswordResetOtpEmail(data.Email, otp)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong sending OTP."})
+		return
+	}
+
+	c.IndentedJSON(200, successMessage)
+}
+
+func ResetPassword(c *gin.Context) {
+	var data struct {
+		Email           string `json:"email" binding:"required,email"`
+		Otp             string `json:"otp" binding:"required"`
+		Password        string `json:"password" binding:"required,min=8"`
+		ConfirmPassword string `json:"confirmPassword" binding:"required,min=8,eqfield=Password"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+	data.Email = users.NormalizeEmail(data.Email)
+
+	if !otps.ConsumeOtp(data.Email, data.Otp, otps.PurposePasswordReset) {
+		c.IndentedJSON(400, gin.H{"message": "Invalid OTP"})
+		return
+	}
+
+	user, err := users.GetUserByEmail(data.Email)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid OTP"})
+		return
+	}
+
+	bcryptPassword, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Failed to reset password"})
+		return
+	}
+
+	if err := users.UpdatePassword(user.Id, string(bcryptPassword)); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Failed to reset password"})
+		return
+	}
+
+	// Resetting is the only way to take over an existing account, so keep a record of it
+	err = auditlogs.AddAuditLog(auditlogs.AuditLog{
+		ActorId:    user.Id,
+		Action:     "user.password_reset",
+		TargetType: "user",
+		TargetId:   user.Id,
+		Ip:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	})
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	// Anyone holding the old password may already be signed in
+	if err := RevokeAllUserSessions(user.Id); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	ClearAuthCookies(c)
+	c.IndentedJSON(200, gin.H{"message": "Password reset successfully"})
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"example/aibooks-backend/serializers"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/keyring"
+	"example/aibooks-backend/middleware"
+	"example/aibooks-backend/models/accesstokens"
+	"example/aibooks-backend/models/refreshtokens"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/models/usersessions"
+	"example/aibooks-backend/utils"
+)
+
+var AccessTokenTTL = 15 * time.Minute
+
+func setCookie(c *gin.Context, name string, value string, path string, maxAge int, httpOnly bool) {
+	secure := os.Getenv("ENV") == "PROD"
+
+	cookie := fmt.Sprintf("%s=%s; SameSite=None; Secure=%v; Path=%s; Max-Age=%d", name, value, secure, path, maxAge)
+	if httpOnly {
+		cookie += "; HttpOnly"
+	}
+
+	// Add instead of Header so the access and refresh cookies can be set on the same response
+	c.Writer.Header().Add("Set-Cookie", cookie)
+}
+
+func createJWTTokenCookie(c *gin.Context, user users.Users, sessionId string) error {
+	jti, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tokenString, err := keyring.Sign(jwt.MapClaims{
+		"user_id": user.Id.Hex(),
+		"roles":   user.GetRoles(),
+		"sid":     sessionId,
+		"iat":     now.Unix(),
+		"exp":     now.Add(AccessTokenTTL).Unix(),
+		"jti":     jti,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	setCookie(c, "auth-token", tokenString, "/", int(refreshtokens.RefreshTokenTTL.Seconds()), false)
+	return nil
+}
+
+func createRefreshTokenCookie(c *gin.Context, userId primitive.ObjectID, familyId primitive.ObjectID) error {
+	refreshToken, err := refreshtokens.IssueRefreshToken(userId, familyId)
+	if err != nil {
+		return err
+	}
+
+	setCookie(c, "refresh-token", refreshToken, "/api/v1/auth", int(refreshtokens.RefreshTokenTTL.Seconds()), true)
+	return nil
+}
+
+// createAuthCookies records a new login session and sets both auth cookies for it.
+// The session id doubles as the refresh token family id.
+func createAuthCookies(c *gin.Context, user users.Users) error {
+	sessionId, err := usersessions.CreateSession(user.Id, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return err
+	}
+
+	if err := createJWTTokenCookie(c, user, sessionId.Hex()); err != nil {
+		return err
+	}
+	return createRefreshTokenCookie(c, user.Id, sessionId)
+}
+
+func ClearAuthCookies(c *gin.Context) {
+	setCookie(c, "auth-token", "", "/", -1, false)
+	setCookie(c, "refresh-token", "", "/api/v1/auth", -1, true)
+}
+
+func Refresh(c *gin.Context) {
+	raw, err := c.Cookie("refresh-token")
+	if err != nil || raw == "" {
+		c.IndentedJSON(401, gin.H{"message": "Failed to retrieve refresh token."})
+		return
+	}
+
+	current, next, err := refreshtokens.RotateRefreshToken(raw)
+	if err == errorHandling.ErrTokenReused {
+		usersessions.RevokeSession(current.FamilyId.Hex(), current.UserId.Hex())
+		ClearAuthCookies(c)
+		c.IndentedJSON(401, gin.H{"message": "Refresh token reuse detected, please log in again."})
+		return
+	} else if err == errorHandling.ErrTokenExpired || err == errorHandling.ErrInvalidToken {
+		ClearAuthCookies(c)
+		c.IndentedJSON(401, gin.H{"message": "Invalid refresh token, please log in again."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	// Roles are read again so changes take effect on the next refresh
+	user, err := users.GetUserById(current.UserId.Hex())
+	if err != nil {
+		c.IndentedJSON(401, gin.H{"message": "Invalid refresh token, please log in again."})
+		return
+	}
+
+	if err := createJWTTokenCookie(c, user, current.FamilyId.Hex()); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Failed to generate token"})
+		return
+	}
+	setCookie(c, "refresh-token", next, "/api/v1/auth", int(refreshtokens.RefreshTokenTTL.Seconds()), true)
+
+	c.IndentedJSON(200, gin.H{"message": "Token refreshed"})
+}
+
+func GetSessions(c *gin.Context) {
+	userId := c.GetString("user_id")
+	currentSessionId := c.GetString("session_id")
+
+	sessions, err := usersessions.GetActiveSessionsByUserId(userId)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, serializers.NewSessions(sessions, currentSessionId))
+}
+
+func RevokeSession(c *gin.Context) {
+	userId := c.GetString("user_id")
+	sessionId := c.Param("id")
+
+	err := usersessions.RevokeSession(sessionId, userId)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Session not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	sessionIdObj, _ := primitive.ObjectIDFromHex(sessionId)
+	if err := refreshtokens.RevokeFamily(sessionIdObj); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if sessionId == c.GetString("session_id") {
+		ClearAuthCookies(c)
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Session revoked"})
+}
+
+// RevokeAllUserSessions ends every login of the user, including their refresh tokens
+// and personal access tokens.
+func RevokeAllUserSessions(userId primitive.ObjectID) error {
+	if err := usersessions.RevokeAllSessions(userId); err != nil {
+		return err
+	}
+	if err := refreshtokens.RevokeAllByUserId(userId); err != nil {
+		return err
+	}
+	return accesstokens.RevokeAllByUserId(userId)
+}
+
+func RevokeAllSessions(c *gin.Context) {
+	userIdObj, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if err := RevokeAllUserSessions(userIdObj); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	ClearAuthCookies(c)
+	c.IndentedJSON(200, gin.H{"message": "Logged out of all sessions"})
+}
+
+// GetCsrfToken issues a new CSRF token as a cookie and in the body. The frontend runs
+// on another origin and can't read the cookie, so it sends the body value back in the
+// X-CSRF-Token header.
+func GetCsrfToken(c *gin.Context) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	setCookie(c, middleware.CsrfCookieName, token, "/", int(refreshtokens.RefreshTokenTTL.Seconds()), true)
+	c.IndentedJSON(200, gin.H{"csrfToken": token})
+}
@@ -1,35 +1,16 @@
 package books
 
 import (
-	"example/aibooks-backend/config/imageconfigs"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/bookassets"
 	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/serializers"
+	"example/aibooks-backend/storage"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-type BookDataResponse struct {
-	Id            primitive.ObjectID      `bson:"_id" json:"id"`
-	Title         string                  `bson:"title" json:"title"`
-	Summary       string                  `bson:"summary" json:"summary"`
-	TotalChapters int                     `bson:"totalChapters" json:"totalChapters"`
-	Genre         []string                `bson:"genre" json:"genre"`
-	PdfUrl        string                  `bson:"pdfUrl" json:"pdfUrl"`
-	PdfPublicId   string                  `bson:"pdfPublicId" json:"pdfPublicId"`
-	CoverImage    imageconfigs.CoverImage `bson:"coverImage" json:"coverImage"`
-	CreatedAt     primitive.DateTime      `bson:"createdAt" json:"createdAt"`
-	Rating        float64                 `bson:"rating" json:"rating"`
-	TotalRatings  int                     `bson:"totalRatings" json:"totalRatings"`
-}
-
-type BookDataShortResponse struct {
-	Id         primitive.ObjectID      `bson:"_id" json:"id"`
-	Title      string                  `bson:"title" json:"title"`
-	Genre      []string                `bson:"genre" json:"genre"`
-	CoverImage imageconfigs.CoverImage `bson:"coverImage" json:"coverImage"`
-}
-
 func GetAllBooks(c *gin.Context) {
 	query := c.DefaultQuery("q", "")
 	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "10"), 10, 64)
@@ -43,35 +24,7 @@ func GetAllBooks(c *gin.Context) {
 		return
 	}
 
-	responseJson := make([]BookDataResponse, len(bookDatas))
-
-	if len(bookDatas) != 0 {
-		for i, bookData := range bookDatas {
-			var rating float64
-			if bookData.TotalRatings != 0 {
-				rating = bookData.SumRatings / float64(bookData.TotalRatings)
-			}
-
-			responseJson[i] = BookDataResponse{
-				Id:            bookData.Id,
-				Title:         bookData.Title,
-				Summary:       bookData.Summary,
-				TotalChapters: bookData.TotalChapters,
-				Genre:         bookData.Genre,
-				PdfUrl:        bookData.PdfUrl,
-				PdfPublicId:   bookData.PdfPublicId,
-				CoverImage: imageconfigs.CoverImage{
-					PublicId: bookData.CoverImagePublicId,
-					Url:      bookData.CoverImageUrl,
-					Width:    imageconfigs.GetDefaultWidth(),
-					Height:   imageconfigs.GetDefaultHeight(),
-				},
-				CreatedAt:    bookData.CreatedAt,
-				Rating:       rating,
-				TotalRatings: bookData.TotalRatings,
-			}
-		}
-	}
+	responseJson := serializers.NewPublicBooks(bookDatas)
 
 	c.IndentedJSON(200, responseJson)
 }
@@ -85,31 +38,44 @@ func GetBookById(c *gin.Context) {
 		return
 	}
 
-	var rating float64 = 0
-	if bookData.TotalRatings != 0 {
-		rating = bookData.SumRatings / float64(bookData.TotalRatings)
+	responseJson := serializers.NewPublicBook(bookData)
+
+	c.IndentedJSON(200, responseJson)
+}
+
+// GetBookPdf serves a book's PDF to a signed in reader. Uploaded PDFs are streamed from
+// the private store, PDFs still on the old media host are redirected to.
+func GetBookPdf(c *gin.Context) {
+	bookData, err := books.GetBookById(c.Param("id"))
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Book not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if !bookassets.IsPdfKey(bookData.PdfPublicId) {
+		if bookData.PdfUrl == "" {
+			c.IndentedJSON(404, gin.H{"message": "This book has no PDF."})
+			return
+		}
+		c.Redirect(302, bookData.PdfUrl)
+		return
 	}
 
-	responseJson := BookDataResponse{
-		Id:            bookData.Id,
-		Title:         bookData.Title,
-		Summary:       bookData.Summary,
-		TotalChapters: bookData.TotalChapters,
-		Genre:         bookData.Genre,
-		PdfUrl:        bookData.PdfUrl,
-		PdfPublicId:   bookData.PdfPublicId,
-		CoverImage: imageconfigs.CoverImage{
-			PublicId: bookData.CoverImagePublicId,
-			Url:      bookData.CoverImageUrl,
-			Width:    imageconfigs.GetDefaultWidth(),
-			Height:   imageconfigs.GetDefaultHeight(),
-		},
-		CreatedAt:    bookData.CreatedAt,
-		Rating:       rating,
-		TotalRatings: bookData.TotalRatings,
+	reader, contentType, err := storage.Get(bookData.PdfPublicId)
+	if err == storage.ErrNotFound {
+		c.IndentedJSON(404, gin.H{"message": "This book has no PDF."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
 	}
+	defer reader.Close()
 
-	c.IndentedJSON(200, responseJson)
+	c.Header("Cache-Control", "private, no-cache")
+	c.DataFromReader(200, -1, contentType, reader, nil)
 }
 
 func SearchSuggestions(c *gin.Context) {
@@ -122,23 +88,7 @@ func SearchSuggestions(c *gin.Context) {
 		return
 	}
 
-	responseJson := make([]BookDataShortResponse, len(suggestions))
-
-	if len(suggestions) != 0 {
-		for i := 0; i < len(suggestions); i++ {
-			responseJson[i] = BookDataShortResponse{
-				Id:    suggestions[i].Id,
-				Title: suggestions[i].Title,
-				Genre: suggestions[i].Genre,
-				CoverImage: imageconfigs.CoverImage{
-					PublicId: suggestions[i].CoverImagePublicId,
-					Url:      suggestions[i].CoverImageUrl,
-					Width:    imageconfigs.GetDefaultWidth(),
-					Height:   imageconfigs.GetDefaultHeight(),
-				},
-			}
-		}
-	}
+	responseJson := serializers.NewBookShorts(suggestions)
 
 	c.IndentedJSON(200, responseJson)
 }
@@ -152,34 +102,7 @@ func GetLatestBooks(c *gin.Context) {
 		return
 	}
 
-	responseJson := make([]BookDataResponse, len(latestBooks))
-
-	if len(latestBooks) != 0 {
-		for i, bookData := range latestBooks {
-
-			var rating float64
-			if bookData.TotalRatings != 0 {
-				rating = bookData.SumRatings / float64(bookData.TotalRatings)
-			}
-
-			responseJson[i] = BookDataResponse{
-				Id:    bookData.Id,
-				Title: bookData.Title,
-				Genre: bookData.Genre,
-				CoverImage: imageconfigs.CoverImage{
-					PublicId: bookData.CoverImagePublicId,
-					Url:      bookData.CoverImageUrl,
-					Width:    imageconfigs.GetDefaultWidth(),
-					Height:   imageconfigs.GetDefaultHeight(),
-				},
-				Summary:       bookData.Summary,
-				TotalChapters: bookData.TotalChapters,
-				CreatedAt:     bookData.CreatedAt,
-				Rating:        rating,
-				TotalRatings:  bookData.TotalRatings,
-			}
-		}
-	}
+	responseJson := serializers.NewPublicBooks(latestBooks)
 
 	c.IndentedJSON(200, responseJson)
 }
@@ -194,34 +117,7 @@ func GetRelatedBooks(c *gin.Context) {
 		return
 	}
 
-	responseJson := make([]BookDataResponse, len(relatedBooks.RelatedBooks))
-
-	if len(relatedBooks.RelatedBooks) != 0 {
-		for i, bookData := range relatedBooks.RelatedBooks {
-
-			var rating float64
-			if bookData.TotalRatings != 0 {
-				rating = bookData.SumRatings / float64(bookData.TotalRatings)
-			}
-
-			responseJson[i] = BookDataResponse{
-				Id:    bookData.Id,
-				Title: bookData.Title,
-				Genre: bookData.Genre,
-				CoverImage: imageconfigs.CoverImage{
-					PublicId: bookData.CoverImagePublicId,
-					Url:      bookData.CoverImageUrl,
-					Width:    imageconfigs.GetDefaultWidth(),
-					Height:   imageconfigs.GetDefaultHeight(),
-				},
-				Summary:       bookData.Summary,
-				TotalChapters: bookData.TotalChapters,
-				CreatedAt:     bookData.CreatedAt,
-				Rating:        rating,
-				TotalRatings:  bookData.TotalRatings,
-			}
-		}
-	}
+	responseJson := serializers.NewPublicBooks(relatedBooks.RelatedBooks)
 
 	c.IndentedJSON(200, responseJson)
 }
@@ -2,6 +2,7 @@ package books
 
 import (
 	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/serializers"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -43,7 +44,7 @@ func GetRatingsById(c *gin.Context) {
 		return
 	}
 
-	c.IndentedJSON(200, rating)
+	c.IndentedJSON(200, serializers.NewRating(rating))
 }
 
 func GetMyRatingForBookId(c *gin.Context) {
@@ -56,7 +57,7 @@ func GetMyRatingForBookId(c *gin.Context) {
 		return
 	}
 
-	c.IndentedJSON(200, rating)
+	c.IndentedJSON(200, serializers.NewRatingWithUser(rating))
 }
 
 func GetRatingsByBookId(c *gin.Context) {
@@ -66,13 +67,16 @@ func GetRatingsByBookId(c *gin.Context) {
 	sortBy := c.DefaultQuery("sortBy", "createdAt")
 	sortOrder, _ := strconv.ParseInt(c.DefaultQuery("sortOrder", "1"), 10, 64)
 
-	rating, err := books.GetRatingsByBookId(bookId, int(limit), int(page), sortBy, int(sortOrder))
+	// Anonymous viewers get the nil id and only see public ratings
+	viewerId, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	ratings, err := books.GetRatingsByBookId(viewerId, bookId, int(limit), int(page), sortBy, int(sortOrder))
 	if err != nil {
 		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
 		return
 	}
 
-	c.IndentedJSON(200, rating)
+	c.IndentedJSON(200, serializers.NewRatingsWithUser(ratings))
 }
 
 func DeleteRatingById(c *gin.Context) {
@@ -0,0 +1,64 @@
+package feed
+
+import (
+	"example/aibooks-backend/models/activities"
+	"example/aibooks-backend/models/follows"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/serializers"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetFeed returns the activity of the users the caller follows, newest first. It pages
+// with ?before=<id of the last item seen>.
+func GetFeed(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	limit = min(max(limit, 1), 50)
+	before, _ := primitive.ObjectIDFromHex(c.Query("before"))
+
+	userIdObj, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	followeeIds, err := follows.GetFolloweeIds(userIdObj)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	followees, err := users.GetPublicUsersByIds(followeeIds)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	// Privacy is applied by only asking for the activity each followee shares
+	actors := make(map[primitive.ObjectID]users.Users, len(followees))
+	ratingActorIds := []primitive.ObjectID{}
+	libraryActorIds := []primitive.ObjectID{}
+	for _, followee := range followees {
+		actors[followee.Id] = followee
+		if followee.RatingsVisibleTo(userIdObj) {
+			ratingActorIds = append(ratingActorIds, followee.Id)
+		}
+		if followee.LibraryVisibleTo(userIdObj) {
+			libraryActorIds = append(libraryActorIds, followee.Id)
+		}
+	}
+
+	items, err := activities.GetFeed(userIdObj, ratingActorIds, libraryActorIds, before, limit)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	response := gin.H{"items": serializers.NewFeedItems(items, actors)}
+	if int64(len(items)) == limit {
+		response["nextBefore"] = items[len(items)-1].Id
+	}
+	c.IndentedJSON(200, response)
+}
@@ -0,0 +1,55 @@
+package files
+
+import (
+	"example/aibooks-backend/models/accesstokens"
+	"example/aibooks-backend/models/bookassets"
+	"example/aibooks-backend/storage"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func fileKey(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("key"), "/")
+}
+
+// IsPrivateFile reports whether the requested file needs a signed in user. Covers and
+// other assets are public, book PDFs and anything else in the private store are not.
+func IsPrivateFile(c *gin.Context) bool {
+	return isPrivateKey(fileKey(c))
+}
+
+func isPrivateKey(key string) bool {
+	return storage.IsPrivate(key) || bookassets.IsPdfKey(key)
+}
+
+// GetFile streams an object from blob storage. It backs storage.Url when no
+// STORAGE_PUBLIC_URL is configured, and storage.ApiUrl always.
+func GetFile(c *gin.Context) {
+	key := fileKey(c)
+
+	private := isPrivateKey(key)
+	if private && c.GetString("access_token_id") != "" && !slices.Contains(c.GetStringSlice("scopes"), accesstokens.ScopeBooksRead) {
+		c.IndentedJSON(403, gin.H{"message": "Token is missing the " + accesstokens.ScopeBooksRead + " scope."})
+		return
+	}
+
+	reader, contentType, err := storage.Get(key)
+	if err == storage.ErrNotFound || err == storage.ErrInvalidKey {
+		c.IndentedJSON(404, gin.H{"message": "File not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	defer reader.Close()
+
+	// Every upload gets a new key, so a stored object never changes
+	if private {
+		c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	c.DataFromReader(200, -1, contentType, reader, nil)
+}
@@ -1,9 +1,8 @@
 package userlibrarys
 
 import (
-	"example/aibooks-backend/config/imageconfigs"
-	"example/aibooks-backend/controllers/books"
 	"example/aibooks-backend/models/userlibrarys"
+	"example/aibooks-backend/serializers"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -36,6 +35,32 @@ func AddBookToLibrary(c *gin.Context) {
 	c.IndentedJSON(200, gin.H{"message": "Book added to library."})
 }
 
+func MarkBookFinished(c *gin.Context) {
+	bookId := c.Param("bookId")
+
+	userId := c.GetString("user_id")
+
+	bookIdObj, err := primitive.ObjectIDFromHex(bookId)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid book id."})
+		return
+	}
+
+	userIdObj, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	err = userlibrarys.MarkBookFinished(userIdObj, bookIdObj)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Book marked as finished."})
+}
+
 func RemoveBookFromLibrary(c *gin.Context) {
 	bookId := c.Param("bookId")
 
@@ -80,38 +105,8 @@ func GetMyLibrary(c *gin.Context) {
 		return
 	}
 
-	fmtBooks := make([]books.BookDataResponse, len(library.Books))
-
-	if len(library.Books) != 0 {
-		for i, bookData := range library.Books {
-			var rating float64
-			if bookData.TotalRatings != 0 {
-				rating = bookData.SumRatings / float64(bookData.TotalRatings)
-			}
-
-			fmtBooks[i] = books.BookDataResponse{
-				Id:            bookData.Id,
-				Title:         bookData.Title,
-				Summary:       bookData.Summary,
-				TotalChapters: bookData.TotalChapters,
-				Genre:         bookData.Genre,
-				PdfUrl:        bookData.PdfUrl,
-				PdfPublicId:   bookData.PdfPublicId,
-				CoverImage: imageconfigs.CoverImage{
-					PublicId: bookData.CoverImagePublicId,
-					Url:      bookData.CoverImageUrl,
-					Width:    imageconfigs.GetDefaultWidth(),
-					Height:   imageconfigs.GetDefaultHeight(),
-				},
-				CreatedAt:    bookData.CreatedAt,
-				Rating:       rating,
-				TotalRatings: bookData.TotalRatings,
-			}
-		}
-	}
-
 	c.IndentedJSON(200, gin.H{
-		"books":      fmtBooks,
+		"books":      serializers.NewPublicBooks(library.Books),
 		"totalBooks": library.TotalBooks,
 		"id":         library.Id,
 	})
@@ -0,0 +1,131 @@
+package users
+
+import (
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/blocks"
+	"example/aibooks-backend/models/follows"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/serializers"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var entryPastTense = map[string]string{
+	blocks.KindBlock: "blocked",
+	blocks.KindMute:  "muted",
+}
+
+func BlockUser(c *gin.Context) {
+	addEntry(c, blocks.KindBlock)
+}
+
+func UnblockUser(c *gin.Context) {
+	removeEntry(c, blocks.KindBlock)
+}
+
+func MuteUser(c *gin.Context) {
+	addEntry(c, blocks.KindMute)
+}
+
+func UnmuteUser(c *gin.Context) {
+	removeEntry(c, blocks.KindMute)
+}
+
+func GetBlockedUsers(c *gin.Context) {
+	getEntries(c, blocks.KindBlock)
+}
+
+func GetMutedUsers(c *gin.Context) {
+	getEntries(c, blocks.KindMute)
+}
+
+func addEntry(c *gin.Context, kind string) {
+	target, err := users.GetUserById(c.Param("id"))
+	if apiErr, ok := err.(errorHandling.APIError); ok && (apiErr.Status == 404 || apiErr.Status == 400) {
+		c.IndentedJSON(404, gin.H{"message": "User not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	userIdObj, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	err = blocks.AddEntry(userIdObj, target.Id, kind)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 400 {
+		c.IndentedJSON(400, gin.H{"message": "You cannot " + kind + " yourself."})
+		return
+	} else if ok && apiErr.Status == 409 {
+		c.IndentedJSON(409, gin.H{"message": "Your " + kind + " list is full."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	// A block ends any follow between the two users, new ones are refused by FollowUser
+	if kind == blocks.KindBlock {
+		if err := follows.RemoveFollowsBetween(userIdObj, target.Id); err != nil {
+			c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "User " + entryPastTense[kind] + "."})
+}
+
+func removeEntry(c *gin.Context, kind string) {
+	targetId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid user id."})
+		return
+	}
+
+	userIdObj, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if err := blocks.RemoveEntry(userIdObj, targetId, kind); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "User un" + entryPastTense[kind] + "."})
+}
+
+func getEntries(c *gin.Context, kind string) {
+	userIdObj, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	entries, err := blocks.GetEntries(userIdObj, kind)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	ids := make([]primitive.ObjectID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.TargetId
+	}
+	people, err := users.GetPublicUsersByIds(ids)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	peopleById := make(map[primitive.ObjectID]users.Users, len(people))
+	for _, person := range people {
+		peopleById[person.Id] = person
+	}
+
+	c.IndentedJSON(200, gin.H{"users": serializers.NewBlockEntries(entries, peopleById)})
+}
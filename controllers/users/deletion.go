@@ -0,0 +1,162 @@
+package users
+
+import (
+	"example/aibooks-backend/controllers/auth"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/accountdeletions"
+	"example/aibooks-backend/models/loginattempts"
+	"example/aibooks-backend/models/otps"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/utils"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// getDeletionGracePeriod reads ACCOUNT_DELETION_GRACE_DAYS. Zero or unset deletes immediately.
+func getDeletionGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func SendDeletionOtp(c *gin.Context) {
+	user, err := users.GetUserById(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	otp, err := otps.GenerateAndSaveOtpFor(user.Email, otps.PurposeAccountDeletion)
+	if err == errorHandling.ErrTooSoon {
+		c.IndentedJSON(400, gin.H{"message": "Too soon, please try again later."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong generating OTP."})
+		return
+	}
+
+	if err := utils.SendAccountDeletionOtpEmail(user.Email, otp); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong sending OTP."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "OTP sent successfully"})
+}
+
+func DeleteAccount(c *gin.Context) {
+	var data struct {
+		Password string `json:"password"`
+		Otp      string `json:"otp"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	user, err := users.GetUserById(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	// Confirmation guesses share the login lockout so the password can't be brute
+	// forced through this endpoint either
+	lockedUntil, err := loginattempts.GetLockedUntil(user.Email, c.ClientIP())
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	if !lockedUntil.IsZero() {
+		auth.RespondLockedOut(c, lockedUntil)
+		return
+	}
+
+	// Accounts created through SSO have no password and confirm with an OTP instead
+	confirmed := false
+	if data.Password != "" && user.Password != "" {
+		confirmed = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password)) == nil
+	} else if data.Otp != "" {
+		confirmed = otps.ConsumeOtp(user.Email, data.Otp, otps.PurposeAccountDeletion)
+	}
+	if !confirmed {
+		if err := loginattempts.RecordFailure(user.Email, c.ClientIP()); err != nil {
+			c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+		c.IndentedJSON(401, gin.H{"message": "Invalid credentials."})
+		return
+	}
+
+	if err := loginattempts.RecordSuccess(user.Email); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	gracePeriod := getDeletionGracePeriod()
+	if gracePeriod > 0 {
+		deleteAt := time.Now().Add(gracePeriod)
+		err := users.ScheduleDeletion(user.Id, &deleteAt)
+		if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 409 {
+			c.IndentedJSON(409, gin.H{"message": "At least one admin must remain."})
+			return
+		} else if err != nil {
+			c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+
+		// Logging in again is how the deletion gets cancelled, until then nothing may
+		// keep using the account
+		if err := auth.RevokeAllUserSessions(user.Id); err != nil {
+			log.Println("Failed to revoke sessions of", user.Id.Hex(), err)
+			c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+
+		auth.ClearAuthCookies(c)
+		c.IndentedJSON(202, gin.H{
+			"message":  "Account scheduled for deletion",
+			"deleteAt": deleteAt,
+		})
+		return
+	}
+
+	err = accountdeletions.DeleteAccount(user)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 409 {
+		c.IndentedJSON(409, gin.H{"message": "At least one admin must remain."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	auth.ClearAuthCookies(c)
+	c.IndentedJSON(200, gin.H{"message": "Account deleted"})
+}
+
+func CancelAccountDeletion(c *gin.Context) {
+	user, err := users.GetUserById(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if user.DeletionScheduledAt == nil {
+		c.IndentedJSON(400, gin.H{"message": "Account is not scheduled for deletion."})
+		return
+	}
+
+	if err := users.ScheduleDeletion(user.Id, nil); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Account deletion cancelled"})
+}
@@ -0,0 +1,284 @@
+package users
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/models/dataexports"
+	"example/aibooks-backend/models/userlibrarys"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/serializers"
+	"example/aibooks-backend/utils"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Exports with more rows than this are built in the background and emailed.
+const syncExportRowLimit = 1000
+
+type exportProfile struct {
+	Id            primitive.ObjectID `json:"id"`
+	Email         string             `json:"email"`
+	EmailVerified bool               `json:"email_verified"`
+	FirstName     string             `json:"first_name"`
+	LastName      string             `json:"last_name"`
+	Roles         []string           `json:"roles"`
+	TotpEnabled   bool               `json:"totp_enabled"`
+	UpdatedAt     primitive.DateTime `json:"updated_at"`
+
+	DisplayName     string            `json:"display_name"`
+	Bio             string            `json:"bio"`
+	FavouriteGenres []string          `json:"favourite_genres"`
+	Preferences     users.Preferences `json:"preferences"`
+}
+
+type exportData struct {
+	ExportedAt time.Time                   `json:"exportedAt"`
+	Profile    exportProfile               `json:"profile"`
+	Ratings    []books.RatingWithBookTitle `json:"ratings"`
+	Library    []userlibrarys.LibraryEntry `json:"library"`
+}
+
+func collectExportData(user users.Users) (exportData, error) {
+	data := exportData{
+		ExportedAt: time.Now(),
+		// Built field by field so secrets like the password hash can't slip in
+		Profile: exportProfile{
+			Id:            user.Id,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			FirstName:     user.FirstName,
+			LastName:      user.LastName,
+			Roles:         user.GetRoles(),
+			TotpEnabled:   user.TotpEnabled,
+			UpdatedAt:     user.UpdatedAt,
+
+			DisplayName:     user.DisplayName,
+			Bio:             user.Bio,
+			FavouriteGenres: user.FavouriteGenres,
+			Preferences:     user.Preferences,
+		},
+	}
+
+	ratings, err := books.GetRatingsWithBookTitleByUserId(user.Id)
+	if err != nil {
+		return data, err
+	}
+	data.Ratings = ratings
+
+	library, err := userlibrarys.GetLibraryEntriesByUserId(user.Id)
+	if err != nil {
+		return data, err
+	}
+	data.Library = library
+
+	return data, nil
+}
+
+func writeCsv(zw *zip.Writer, name string, rows [][]string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+func formatDateTime(dt primitive.DateTime) string {
+	return dt.Time().UTC().Format(time.RFC3339)
+}
+
+func buildArchive(data exportData, format string) ([]byte, string, error) {
+	fileName := "aibooks-export-" + data.ExportedAt.UTC().Format("20060102-150405")
+
+	if format == "json" {
+		b, err := json.MarshalIndent(data, "", "  ")
+		return b, fileName + ".json", err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	profileRows := [][]string{
+		{"id", "email", "email_verified", "first_name", "last_name", "roles", "totp_enabled", "updated_at", "display_name", "bio", "favourite_genres", "theme", "language"},
+		{
+			data.Profile.Id.Hex(),
+			data.Profile.Email,
+			strconv.FormatBool(data.Profile.EmailVerified),
+			data.Profile.FirstName,
+			data.Profile.LastName,
+			strings.Join(data.Profile.Roles, ";"),
+			strconv.FormatBool(data.Profile.TotpEnabled),
+			formatDateTime(data.Profile.UpdatedAt),
+			data.Profile.DisplayName,
+			data.Profile.Bio,
+			strings.Join(data.Profile.FavouriteGenres, ";"),
+			data.Profile.Preferences.Theme,
+			data.Profile.Preferences.Language,
+		},
+	}
+	if err := writeCsv(zw, "profile.csv", profileRows); err != nil {
+		return nil, "", err
+	}
+
+	ratingRows := [][]string{{"id", "book_id", "book_title", "rating", "review", "created_at", "updated_at"}}
+	for _, r := range data.Ratings {
+		ratingRows = append(ratingRows, []string{
+			r.Id.Hex(), r.BookId.Hex(), r.BookTitle, strconv.Itoa(r.Rating), r.Review, formatDateTime(r.CreatedAt), formatDateTime(r.UpdatedAt),
+		})
+	}
+	if err := writeCsv(zw, "ratings.csv", ratingRows); err != nil {
+		return nil, "", err
+	}
+
+	libraryRows := [][]string{{"book_id", "title"}}
+	for _, e := range data.Library {
+		libraryRows = append(libraryRows, []string{e.BookId.Hex(), e.Title})
+	}
+	if err := writeCsv(zw, "library.csv", libraryRows); err != nil {
+		return nil, "", err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), fileName + ".zip", nil
+}
+
+func sendArchive(c *gin.Context, fileName string, data []byte) {
+	contentType := utils.Ternary(strings.HasSuffix(fileName, ".zip"), "application/zip", "application/json")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	c.Data(200, contentType, data)
+}
+
+func runExport(user users.Users, export dataexports.DataExport) {
+	data, err := collectExportData(user)
+	if err != nil {
+		dataexports.FailExport(export.Id, err.Error())
+		return
+	}
+
+	archive, fileName, err := buildArchive(data, export.Format)
+	if err != nil {
+		dataexports.FailExport(export.Id, err.Error())
+		return
+	}
+
+	if err := dataexports.CompleteExport(export.Id, fileName, archive); err != nil {
+		dataexports.FailExport(export.Id, err.Error())
+		return
+	}
+
+	backendUrl := utils.Ternary(os.Getenv("ENV") == "PROD", os.Getenv("BACKEND_PROD_URL"), os.Getenv("BACKEND_DEV_URL"))
+	link := backendUrl + "/api/v1/users/export/" + export.Id.Hex() + "/download"
+	if err := utils.SendDataExportReadyEmail(user.Email, link); err != nil {
+		log.Println("Failed to send data export email:", err)
+	}
+}
+
+func ExportUserData(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.IndentedJSON(400, gin.H{"message": "Format must be json or zip."})
+		return
+	}
+
+	user, err := users.GetUserById(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	ratingsCount, err := books.CountRatingsByUserId(user.Id)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	library, err := userlibrarys.GetLibraryByUserId(user.Id, 1, 1)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if ratingsCount+library.TotalBooks > syncExportRowLimit || c.Query("async") == "true" {
+		export, err := dataexports.CreateExport(user.Id, format)
+		if err != nil {
+			c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+
+		go runExport(user, export)
+
+		c.IndentedJSON(202, gin.H{
+			"message": "Your export is being prepared, we will email you when it is ready.",
+			"export":  serializers.NewDataExport(export),
+		})
+		return
+	}
+
+	data, err := collectExportData(user)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	archive, fileName, err := buildArchive(data, format)
+	if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	sendArchive(c, fileName, archive)
+}
+
+func GetExportStatus(c *gin.Context) {
+	export, err := dataexports.GetExportById(c.Param("id"), c.GetString("user_id"))
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Export not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, serializers.NewDataExport(export))
+}
+
+func DownloadExport(c *gin.Context) {
+	export, err := dataexports.GetExportById(c.Param("id"), c.GetString("user_id"))
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Export not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if export.Status != dataexports.StatusReady {
+		c.IndentedJSON(409, gin.H{"message": "Export is not ready yet.", "status": export.Status})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := dataexports.DownloadExport(export, &buf); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	sendArchive(c, export.FileName, buf.Bytes())
+}
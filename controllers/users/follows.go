@@ -0,0 +1,125 @@
+package users
+
+import (
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/follows"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/serializers"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func FollowUser(c *gin.Context) {
+	followee, err := users.GetUserById(c.Param("id"))
+	if apiErr, ok := err.(errorHandling.APIError); ok && (apiErr.Status == 404 || apiErr.Status == 400) {
+		c.IndentedJSON(404, gin.H{"message": "User not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	followerId, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	err = follows.FollowUser(followerId, followee.Id)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 400 {
+		c.IndentedJSON(400, gin.H{"message": "You cannot follow yourself."})
+		return
+	} else if ok && apiErr.Status == 403 {
+		c.IndentedJSON(403, gin.H{"message": "You cannot follow this user."})
+		return
+	} else if ok && apiErr.Status == 409 {
+		c.IndentedJSON(409, gin.H{"message": "You are following too many users."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "User followed."})
+}
+
+func UnfollowUser(c *gin.Context) {
+	followeeId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid user id."})
+		return
+	}
+
+	followerId, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if err := follows.UnfollowUser(followerId, followeeId); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "User unfollowed."})
+}
+
+func GetFollowers(c *gin.Context) {
+	getFollowList(c, follows.GetFollowers, func(f follows.Follow) primitive.ObjectID { return f.FollowerId })
+}
+
+func GetFollowing(c *gin.Context) {
+	getFollowList(c, follows.GetFollowing, func(f follows.Follow) primitive.ObjectID { return f.FolloweeId })
+}
+
+// getFollowList pages through a user's followers or followed users with ?before=<followId>.
+// Lists of private profiles are only shown to their owner.
+func getFollowList(c *gin.Context, list func(primitive.ObjectID, primitive.ObjectID, int64) ([]follows.Follow, error), userOf func(follows.Follow) primitive.ObjectID) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	limit = min(max(limit, 1), 50)
+	before, _ := primitive.ObjectIDFromHex(c.Query("before"))
+
+	viewerId, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	user, err := users.GetUserForViewer(c.Param("id"), viewerId)
+	if apiErr, ok := err.(errorHandling.APIError); ok && (apiErr.Status == 404 || apiErr.Status == 400) {
+		c.IndentedJSON(404, gin.H{"message": "User not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if !user.ProfileVisibleTo(viewerId) {
+		c.IndentedJSON(403, gin.H{"message": "This profile is private."})
+		return
+	}
+
+	results, err := list(user.Id, before, limit)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	ids := make([]primitive.ObjectID, len(results))
+	for i, follow := range results {
+		ids[i] = userOf(follow)
+	}
+	people, err := users.GetPublicUsersByIds(ids)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	peopleById := make(map[primitive.ObjectID]users.Users, len(people))
+	for _, person := range people {
+		peopleById[person.Id] = person
+	}
+
+	response := gin.H{"users": serializers.NewFollowEntries(results, peopleById, userOf)}
+	if int64(len(results)) == limit {
+		response["nextBefore"] = results[len(results)-1].Id
+	}
+	c.IndentedJSON(200, response)
+}
@@ -0,0 +1,382 @@
+package users
+
+import (
+	"bytes"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/auditlogs"
+	"example/aibooks-backend/models/avatars"
+	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/models/follows"
+	"example/aibooks-backend/models/otps"
+	"example/aibooks-backend/models/refreshtokens"
+	"example/aibooks-backend/models/userlibrarys"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/models/usersessions"
+	"example/aibooks-backend/serializers"
+	"example/aibooks-backend/utils"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Number of recent reviews and library books shown on a profile page
+const (
+	profileReviewLimit  = 10
+	profileLibraryLimit = 20
+)
+
+// GetProfile renders another user's public profile, leaving out whatever their
+// privacy settings hide from the viewer.
+func GetProfile(c *gin.Context) {
+	viewerId, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	user, err := users.GetUserForViewer(c.Param("id"), viewerId)
+	if apiErr, ok := err.(errorHandling.APIError); ok && (apiErr.Status == 404 || apiErr.Status == 400) {
+		c.IndentedJSON(404, gin.H{"message": "User not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	profile := serializers.NewProfile(user, viewerId)
+
+	profile.FollowerCount, profile.FollowingCount, err = follows.CountFollows(user.Id)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	if !viewerId.IsZero() && viewerId != user.Id {
+		profile.IsFollowing, err = follows.IsFollowing(viewerId, user.Id)
+		if err != nil {
+			c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+	}
+
+	if user.RatingsVisibleTo(viewerId) {
+		stats, err := books.GetRatingStatsByUserId(user.Id)
+		if err != nil {
+			c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+		profile.Stats = &stats
+
+		ratings, err := books.GetRecentRatingsWithBookTitleByUserId(user.Id, profileReviewLimit)
+		if err != nil {
+			c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+		recentReviews := serializers.NewRatingsWithBookTitle(ratings)
+		profile.RecentReviews = &recentReviews
+	}
+
+	if user.LibraryVisibleTo(viewerId) {
+		library, err := userlibrarys.GetLibraryByUserId(user.Id, 1, profileLibraryLimit)
+		if err != nil {
+			c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+			return
+		}
+		libraryBooks := serializers.NewPublicBooks(library.Books)
+		profile.Library = &libraryBooks
+	}
+
+	c.IndentedJSON(200, profile)
+}
+
+func UpdateProfile(c *gin.Context) {
+	var data struct {
+		DisplayName     *string   `json:"display_name" binding:"omitempty,max=50"`
+		Bio             *string   `json:"bio" binding:"omitempty,max=500"`
+		FavouriteGenres *[]string `json:"favourite_genres" binding:"omitempty,max=10,dive,required,max=50"`
+		Preferences     *struct {
+			Theme    *string `json:"theme" binding:"omitempty,oneof=light dark system"`
+			Language *string `json:"language" binding:"omitempty,bcp47_language_tag"`
+		} `json:"preferences"`
+		Privacy *struct {
+			PrivateProfile *bool `json:"private_profile"`
+			HideLibrary    *bool `json:"hide_library"`
+			HideRatings    *bool `json:"hide_ratings"`
+		} `json:"privacy"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	update := users.ProfileUpdate{
+		DisplayName: data.DisplayName,
+		Bio:         data.Bio,
+	}
+	if update.DisplayName != nil {
+		displayName := strings.TrimSpace(*update.DisplayName)
+		update.DisplayName = &displayName
+	}
+	if data.FavouriteGenres != nil {
+		genres := []string{}
+		for _, genre := range *data.FavouriteGenres {
+			genre = strings.TrimSpace(genre)
+			if genre != "" && !slices.Contains(genres, genre) {
+				genres = append(genres, genre)
+			}
+		}
+		update.FavouriteGenres = &genres
+	}
+	if data.Preferences != nil {
+		update.Theme = data.Preferences.Theme
+		update.Language = data.Preferences.Language
+	}
+	if data.Privacy != nil {
+		update.PrivateProfile = data.Privacy.PrivateProfile
+		update.HideLibrary = data.Privacy.HideLibrary
+		update.HideRatings = data.Privacy.HideRatings
+	}
+
+	userIdObj, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	user, err := users.UpdateProfile(userIdObj, update)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, serializers.NewSelfUser(user))
+}
+
+func UploadAvatar(c *gin.Context) {
+	// Leave some room for the multipart framing around the image
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, avatars.MaxAvatarSize+1<<20)
+
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Missing avatar file."})
+		return
+	}
+	if fileHeader.Size > avatars.MaxAvatarSize {
+		c.IndentedJSON(413, gin.H{"message": "Avatar must be at most 2 MB."})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, avatars.MaxAvatarSize+1))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	userIdObj, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	fileId, err := avatars.SaveAvatar(userIdObj, data)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 413 {
+		c.IndentedJSON(413, gin.H{"message": "Avatar must be at most 2 MB."})
+		return
+	} else if ok && apiErr.Status == 415 {
+		c.IndentedJSON(415, gin.H{"message": "Avatar must be a JPEG, PNG or WebP image."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	previous, err := users.SetAvatar(userIdObj, &fileId)
+	if err != nil {
+		avatars.DeleteAvatar(fileId)
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	if previous != nil {
+		if err := avatars.DeleteAvatar(*previous); err != nil {
+			log.Println("Failed to delete previous avatar", previous.Hex(), err)
+		}
+	}
+
+	user, err := users.GetUserById(userIdObj.Hex())
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, serializers.NewSelfUser(user))
+}
+
+func DeleteAvatar(c *gin.Context) {
+	userIdObj, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	previous, err := users.SetAvatar(userIdObj, nil)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	if previous != nil {
+		if err := avatars.DeleteAvatar(*previous); err != nil {
+			log.Println("Failed to delete avatar", previous.Hex(), err)
+		}
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Avatar removed."})
+}
+
+func GetAvatar(c *gin.Context) {
+	user, err := users.GetUserById(c.Param("id"))
+	if err != nil || user.AvatarFileId == nil {
+		c.IndentedJSON(404, gin.H{"message": "Avatar not found."})
+		return
+	}
+
+	var buf bytes.Buffer
+	contentType, err := avatars.DownloadAvatar(*user.AvatarFileId, &buf)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Avatar not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	// Avatar urls carry the file id, so a new upload never hits a stale cache
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(200, contentType, buf.Bytes())
+}
+
+func SendEmailChangeOtp(c *gin.Context) {
+	var data struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+	newEmail := users.NormalizeEmail(data.Email)
+
+	user, err := users.GetUserById(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		c.IndentedJSON(400, gin.H{"message": "That is already your email."})
+		return
+	}
+
+	// Same response whether or not the address is taken, so this can't be used to probe
+	// emails. ConfirmEmailChange refuses a taken address anyway.
+	successMessage := gin.H{"message": "OTP sent successfully"}
+	if _, err := users.GetUserByEmail(newEmail); err == nil {
+		c.IndentedJSON(200, successMessage)
+		return
+	}
+
+	otp, err := otps.GenerateAndSaveOtpFor(newEmail, otps.PurposeEmailChange)
+	if err == errorHandling.ErrTooSoon {
+		// Another account may have asked for this address, a distinct answer would tell
+		c.IndentedJSON(200, successMessage)
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong generating OTP."})
+		return
+	}
+
+	if err := users.SetPendingEmail(user.Id, newEmail); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	if err := utils.SendEmailChangeOtpEmail(newEmail, otp); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong sending OTP."})
+		return
+	}
+
+	c.IndentedJSON(200, successMessage)
+}
+
+func VerifyEmailChange(c *gin.Context) {
+	var data struct {
+		Otp string `json:"otp" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	user, err := users.GetUserById(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	if user.PendingEmail == "" {
+		c.IndentedJSON(400, gin.H{"message": "No email change in progress."})
+		return
+	}
+
+	if !otps.ConsumeOtp(user.PendingEmail, data.Otp, otps.PurposeEmailChange) {
+		c.IndentedJSON(400, gin.H{"message": "Invalid OTP"})
+		return
+	}
+
+	err = users.ConfirmEmailChange(user.Id, user.PendingEmail)
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 409 {
+		c.IndentedJSON(409, gin.H{"message": "Email already in use."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	// Whoever knew the old address may have signed in with it, so only this session stays
+	sessionIdObj, _ := primitive.ObjectIDFromHex(c.GetString("session_id"))
+	if err := usersessions.RevokeOtherSessions(user.Id, sessionIdObj); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+	if err := refreshtokens.RevokeOtherFamilies(user.Id, sessionIdObj); err != nil {
+		c.IndentedJSON(500, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	err = auditlogs.AddAuditLog(auditlogs.AuditLog{
+		ActorId:    user.Id,
+		Action:     "user.email_changed",
+		TargetType: "user",
+		TargetId:   user.Id,
+		Ip:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Details:    bson.M{"from": user.Email, "to": user.PendingEmail},
+	})
+	if err != nil {
+		log.Println("Failed to write audit log for email change of", user.Id.Hex(), err)
+	}
+
+	// Let the old address know in case the account was taken over
+	if err := utils.SendEmailChangedEmail(user.Email, user.PendingEmail); err != nil {
+		log.Println("Failed to send email changed notice to", user.Id.Hex(), err)
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Email changed successfully"})
+}
@@ -0,0 +1,79 @@
+package users
+
+import (
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/accesstokens"
+	"example/aibooks-backend/serializers"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func CreateAccessToken(c *gin.Context) {
+	var data struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		Scopes        []string `json:"scopes" binding:"required,min=1"`
+		ExpiresInDays int      `json:"expiresInDays" binding:"min=0,max=365"`
+	}
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	for _, scope := range data.Scopes {
+		if !slices.Contains(accesstokens.ValidScopes, scope) {
+			c.IndentedJSON(400, gin.H{"message": "Invalid scope: " + scope})
+			return
+		}
+	}
+
+	userIdObj, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	var expiresAt *time.Time
+	if data.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, data.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	token, raw, err := accesstokens.CreateAccessToken(userIdObj, data.Name, data.Scopes, expiresAt)
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	// The raw token is only stored hashed, this is the only time it is shown
+	c.IndentedJSON(201, gin.H{
+		"token":       raw,
+		"accessToken": serializers.NewAccessToken(token),
+	})
+}
+
+func GetAccessTokens(c *gin.Context) {
+	tokens, err := accesstokens.GetAccessTokensByUserId(c.GetString("user_id"))
+	if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, serializers.NewAccessTokens(tokens))
+}
+
+func DeleteAccessToken(c *gin.Context) {
+	err := accesstokens.DeleteAccessToken(c.Param("id"), c.GetString("user_id"))
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		c.IndentedJSON(404, gin.H{"message": "Token not found."})
+		return
+	} else if err != nil {
+		c.IndentedJSON(400, gin.H{"message": "Uh oh! Something went wrong."})
+		return
+	}
+
+	c.IndentedJSON(200, gin.H{"message": "Token deleted."})
+}
@@ -2,6 +2,7 @@ package users
 
 import (
 	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/serializers"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,5 +16,5 @@ func GetUser(c *gin.Context) {
 		return
 	}
 
-	c.IndentedJSON(200, user)
+	c.IndentedJSON(200, serializers.NewSelfUser(user))
 }
@@ -0,0 +1,12 @@
+package wellknown
+
+import (
+	"example/aibooks-backend/keyring"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetJwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, keyring.GetJwks())
+}
@@ -0,0 +1,73 @@
+package email
+
+import (
+	"errors"
+	"os"
+)
+
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	Html    string
+}
+
+// Sender delivers a fully rendered message. Drivers only differ in transport.
+type Sender interface {
+	Send(msg Message) error
+}
+
+var defaultSender Sender
+
+var ErrNotLoaded = errors.New("email sender not loaded")
+
+// Load picks the driver from EMAIL_DRIVER: smtp (default), outbox or noop.
+func Load() error {
+	sender, err := NewSender(os.Getenv("EMAIL_DRIVER"))
+	if err != nil {
+		return err
+	}
+	defaultSender = sender
+	return nil
+}
+
+func NewSender(driver string) (Sender, error) {
+	switch driver {
+	case "", "smtp":
+		return NewSmtpSenderFromEnv()
+	case "outbox":
+		dir := os.Getenv("EMAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "tmp/outbox"
+		}
+		return NewOutboxSender(dir, getFromAddress())
+	case "noop":
+		return NoopSender{}, nil
+	default:
+		return nil, errors.New("unknown EMAIL_DRIVER " + driver)
+	}
+}
+
+func getFromAddress() string {
+	if from := os.Getenv("EMAIL_FROM"); from != "" {
+		return from
+	}
+	return os.Getenv("EMAIL")
+}
+
+func Send(msg Message) error {
+	if defaultSender == nil {
+		return ErrNotLoaded
+	}
+	return defaultSender.Send(msg)
+}
+
+// SendTemplate renders the named template and sends it to a single recipient.
+func SendTemplate(recipient string, name string, data any) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = []string{recipient}
+	return Send(msg)
+}
@@ -0,0 +1,41 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OutboxSender writes every message as an .eml file instead of sending it, for
+// local development and tests.
+type OutboxSender struct {
+	Dir  string
+	From string
+}
+
+func NewOutboxSender(dir string, from string) (*OutboxSender, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if from == "" {
+		from = "aibooks@localhost"
+	}
+	return &OutboxSender{Dir: dir, From: from}, nil
+}
+
+func (s *OutboxSender) Send(msg Message) error {
+	body, err := buildMime(s.From, msg)
+	if err != nil {
+		return err
+	}
+
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + randomId()[:8] + ".eml"
+	return os.WriteFile(filepath.Join(s.Dir, name), body, 0644)
+}
+
+// NoopSender drops every message.
+type NoopSender struct{}
+
+func (NoopSender) Send(msg Message) error {
+	return nil
+}
@@ -0,0 +1,126 @@
+package email
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// SmtpTimeout limits connecting to the server as well as the rest of a single send.
+var SmtpTimeout = 30 * time.Second
+
+// SmtpSender delivers through an SMTP server. Tls is "starttls" (default, usually
+// port 587) or "tls" for implicit TLS (usually port 465).
+type SmtpSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	Tls      string
+}
+
+func getEnvOr(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// NewSmtpSenderFromEnv reads SMTP_* settings, falling back to the gmail defaults and
+// the EMAIL/EMAIL_PASSWORD credentials this server has always used.
+func NewSmtpSenderFromEnv() (*SmtpSender, error) {
+	s := &SmtpSender{
+		Host:     getEnvOr("SMTP_HOST", "smtp.gmail.com"),
+		Port:     getEnvOr("SMTP_PORT", "587"),
+		Username: getEnvOr("SMTP_USERNAME", os.Getenv("EMAIL")),
+		Password: getEnvOr("SMTP_PASSWORD", os.Getenv("EMAIL_PASSWORD")),
+		From:     getFromAddress(),
+		Tls:      getEnvOr("SMTP_TLS", "starttls"),
+	}
+
+	if s.Tls != "starttls" && s.Tls != "tls" {
+		return nil, fmt.Errorf("SMTP_TLS must be starttls or tls, got %q", s.Tls)
+	}
+	if s.From == "" {
+		return nil, fmt.Errorf("EMAIL_FROM or EMAIL must be set for the smtp driver")
+	}
+	return s, nil
+}
+
+func (s *SmtpSender) Send(msg Message) error {
+	body, err := buildMime(s.From, msg)
+	if err != nil {
+		return err
+	}
+
+	fromAddr, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(s.Host, s.Port)
+	tlsConfig := &tls.Config{ServerName: s.Host}
+
+	dialer := &net.Dialer{Timeout: SmtpTimeout}
+	var conn net.Conn
+	if s.Tls == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	// Bounds the whole conversation, so a server that stops answering can't hold up the caller
+	if err := conn.SetDeadline(time.Now().Add(SmtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if s.Tls != "tls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return err
+		}
+	}
+	defer client.Close()
+
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(fromAddr.Address); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(strings.TrimSpace(to)); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,38 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Each template file defines a "subject", a "text" and an "html" block. The html
+// block is rendered with html/template so data is escaped.
+//
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+var textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFiles, "templates/*.tmpl"))
+var htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/*.tmpl"))
+
+func Render(name string, data any) (Message, error) {
+	var msg Message
+
+	var subject, text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return msg, err
+	}
+	if err := textTemplates.ExecuteTemplate(&text, name+".text", data); err != nil {
+		return msg, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return msg, err
+	}
+
+	msg.Subject = strings.TrimSpace(subject.String())
+	msg.Text = strings.TrimSpace(text.String()) + "\n"
+	msg.Html = html.String()
+	return msg, nil
+}
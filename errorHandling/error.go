@@ -14,6 +14,9 @@ type APIError struct {
 }
 
 var ErrTooSoon = errors.New("too soon")
+var ErrInvalidToken = errors.New("invalid token")
+var ErrTokenExpired = errors.New("token expired")
+var ErrTokenReused = errors.New("token reused")
 
 func (e APIError) Error() string {
 	return e.Message
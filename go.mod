@@ -3,6 +3,7 @@ module example/aibooks-backend
 go 1.23.2
 
 require (
+	github.com/chai2010/webp v1.4.0
 	github.com/coreos/go-oidc/v3 v3.11.0
 	github.com/gin-contrib/cors v1.7.2
 	github.com/gin-contrib/sessions v1.0.1
@@ -11,6 +12,7 @@ require (
 	github.com/joho/godotenv v1.5.1
 	go.mongodb.org/mongo-driver v1.17.1
 	golang.org/x/crypto v0.30.0
+	golang.org/x/image v0.23.0
 	golang.org/x/oauth2 v0.24.0
 )
 
@@ -0,0 +1,197 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Key is one entry of the keyring. Every key is bound to a single algorithm and a
+// token is only accepted if its alg header matches the key its kid points at.
+type Key struct {
+	Id         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+// Keyring signs with the first key and verifies with all of them, so rotated out
+// keys stay valid until the tokens they signed have expired.
+type Keyring struct {
+	signingKey *Key
+	keys       map[string]*Key
+	order      []string
+}
+
+var defaultKeyring *Keyring
+
+var ErrNotLoaded = errors.New("keyring not loaded")
+
+// Load builds the default keyring from JWT_KEYS, a comma separated list of kid=path
+// pairs pointing at PEM files. The first entry must be a private key and is used for
+// signing. Later entries may be private or public keys and are only used to verify.
+// When JWT_KEYS is not set, JWT_SECRET is used as a single HS256 key.
+func Load() error {
+	ring, err := New(os.Getenv("JWT_KEYS"), os.Getenv("JWT_SECRET"))
+	if err != nil {
+		return err
+	}
+	defaultKeyring = ring
+	return nil
+}
+
+func New(keysSpec string, secret string) (*Keyring, error) {
+	ring := &Keyring{keys: map[string]*Key{}}
+
+	if strings.TrimSpace(keysSpec) == "" {
+		if secret == "" {
+			return nil, errors.New("neither JWT_KEYS nor JWT_SECRET is set")
+		}
+		key := &Key{Id: "default", Method: jwt.SigningMethodHS256, PrivateKey: []byte(secret)}
+		ring.add(key)
+		return ring, nil
+	}
+
+	for _, entry := range strings.Split(keysSpec, ",") {
+		kid, path, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || kid == "" || path == "" {
+			return nil, fmt.Errorf("invalid JWT_KEYS entry %q, expected kid=path", entry)
+		}
+		if _, exists := ring.keys[kid]; exists {
+			return nil, fmt.Errorf("duplicate kid %q in JWT_KEYS", kid)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading key %q: %w", kid, err)
+		}
+
+		key, err := parsePEM(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing key %q: %w", kid, err)
+		}
+
+		if ring.signingKey == nil && key.PrivateKey == nil {
+			return nil, fmt.Errorf("the first JWT_KEYS entry %q must be a private key", kid)
+		}
+		ring.add(key)
+	}
+
+	return ring, nil
+}
+
+func (r *Keyring) add(key *Key) {
+	if r.signingKey == nil {
+		r.signingKey = key
+	}
+	r.keys[key.Id] = key
+	r.order = append(r.order, key.Id)
+}
+
+func parsePEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{Id: kid, Method: jwt.SigningMethodRS256, PrivateKey: k, PublicKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{Id: kid, Method: jwt.SigningMethodRS256, PublicKey: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{Id: kid, Method: jwt.SigningMethodEdDSA, PrivateKey: k, PublicKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{Id: kid, Method: jwt.SigningMethodEdDSA, PublicKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, only RSA and Ed25519 keys are supported", parsed)
+	}
+}
+
+func (r *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.signingKey.Method, claims)
+	token.Header["kid"] = r.signingKey.Id
+	return token.SignedString(r.signingKey.PrivateKey)
+}
+
+// Parse verifies a token against the key named by its kid header. The alg header has
+// to match that key's algorithm exactly, which rules out alg=none and using a public
+// key as an HMAC secret.
+func (r *Keyring) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := r.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q for kid %q", token.Method.Alg(), kid)
+		}
+
+		if key.Method == jwt.SigningMethodHS256 {
+			return key.PrivateKey, nil
+		}
+		return key.PublicKey, nil
+	})
+}
+
+// PublicKeys returns the asymmetric keys in the keyring, for publishing as a JWKS.
+// HMAC keys are secrets and are never included.
+func (r *Keyring) PublicKeys() []*Key {
+	var keys []*Key
+	for _, kid := range r.order {
+		key := r.keys[kid]
+		if key.PublicKey != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func Sign(claims jwt.Claims) (string, error) {
+	if defaultKeyring == nil {
+		return "", ErrNotLoaded
+	}
+	return defaultKeyring.Sign(claims)
+}
+
+func Parse(tokenString string) (*jwt.Token, error) {
+	if defaultKeyring == nil {
+		return nil, ErrNotLoaded
+	}
+	return defaultKeyring.Parse(tokenString)
+}
+
+func PublicKeys() []*Key {
+	if defaultKeyring == nil {
+		return nil
+	}
+	return defaultKeyring.PublicKeys()
+}
@@ -0,0 +1,202 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type testKeys struct {
+	rsaKey     *rsa.PrivateKey
+	edKey      ed25519.PrivateKey
+	rsaPubPath string
+}
+
+// newTestKeyring builds a keyring signing with a fresh RSA key "rsa-1", that also
+// verifies with an Ed25519 key "ed-1" and the public half of the RSA key as "rsa-old".
+func newTestKeyring(t *testing.T) (*Keyring, testKeys) {
+	t.Helper()
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePEM := func(name string, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	edDer, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPubDer, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPath := writePEM("rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	edPath := writePEM("ed.pem", "PRIVATE KEY", edDer)
+	rsaPubPath := writePEM("rsa-pub.pem", "PUBLIC KEY", rsaPubDer)
+
+	ring, err := New("rsa-1="+rsaPath+", ed-1="+edPath+", rsa-old="+rsaPubPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring, testKeys{rsaKey: rsaKey, edKey: edKey, rsaPubPath: rsaPubPath}
+}
+
+func signWith(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.StandardClaims{
+		Subject:   "user-1",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestParse(t *testing.T) {
+	ring, keys := newTestKeyring(t)
+
+	// The PEM bytes of the public key are what an attacker would use as an HMAC secret
+	rsaPubPEM, err := os.ReadFile(keys.rsaPubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := ring.Sign(jwt.StandardClaims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"keyring signed", signed, true},
+		{"RS256 with an old public key", signWith(t, jwt.SigningMethodRS256, "rsa-old", keys.rsaKey), true},
+		{"EdDSA", signWith(t, jwt.SigningMethodEdDSA, "ed-1", keys.edKey), true},
+		{"HS256 with an RSA kid", signWith(t, jwt.SigningMethodHS256, "rsa-1", rsaPubPEM), false},
+		{"HS256 with a public only RSA kid", signWith(t, jwt.SigningMethodHS256, "rsa-old", rsaPubPEM), false},
+		{"RS256 with the Ed25519 kid", signWith(t, jwt.SigningMethodRS256, "ed-1", keys.rsaKey), false},
+		{"unknown kid", signWith(t, jwt.SigningMethodRS256, "rsa-2", keys.rsaKey), false},
+		{"missing kid", signWith(t, jwt.SigningMethodRS256, "", keys.rsaKey), false},
+		{"alg none", signWith(t, jwt.SigningMethodNone, "rsa-1", jwt.UnsafeAllowNoneSignatureType), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := ring.Parse(tt.token)
+			if tt.valid {
+				if err != nil || !token.Valid {
+					t.Fatalf("Parse failed: %v", err)
+				}
+				if sub := token.Claims.(jwt.MapClaims)["sub"]; sub != "user-1" {
+					t.Errorf("sub = %v, want user-1", sub)
+				}
+			} else if err == nil {
+				t.Error("Parse accepted the token")
+			}
+		})
+	}
+}
+
+func TestSignUsesFirstKey(t *testing.T) {
+	ring, _ := newTestKeyring(t)
+
+	signed, err := ring.Sign(jwt.StandardClaims{Subject: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != "rsa-1" || token.Header["alg"] != "RS256" {
+		t.Errorf("header = %v, want kid rsa-1 and alg RS256", token.Header)
+	}
+}
+
+func TestNewFromSecret(t *testing.T) {
+	ring, err := New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := ring.Sign(jwt.StandardClaims{Subject: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ring.Parse(signed); err != nil {
+		t.Errorf("Parse of an HS256 token: %v", err)
+	}
+	if keys := ring.PublicKeys(); len(keys) != 0 {
+		t.Errorf("PublicKeys = %d keys, want the HMAC secret left out", len(keys))
+	}
+
+	if _, err := New("", ""); err == nil {
+		t.Error("New without keys or secret succeeded")
+	}
+}
+
+func TestGetJwks(t *testing.T) {
+	ring, keys := newTestKeyring(t)
+	defaultKeyring = ring
+	defer func() { defaultKeyring = nil }()
+
+	rsaN := base64.RawURLEncoding.EncodeToString(keys.rsaKey.N.Bytes())
+	rsaE := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(keys.rsaKey.E)).Bytes())
+	edX := base64.RawURLEncoding.EncodeToString(keys.edKey.Public().(ed25519.PublicKey))
+
+	want := []Jwk{
+		{Kty: "RSA", Kid: "rsa-1", Alg: "RS256", Use: "sig", N: rsaN, E: rsaE},
+		{Kty: "OKP", Kid: "ed-1", Alg: "EdDSA", Use: "sig", Crv: "Ed25519", X: edX},
+		{Kty: "RSA", Kid: "rsa-old", Alg: "RS256", Use: "sig", N: rsaN, E: rsaE},
+	}
+
+	got := GetJwks().Keys
+	if len(got) != len(want) {
+		t.Fatalf("GetJwks returned %d keys, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("key %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if rsaE != "AQAB" {
+		t.Errorf("e = %q, want AQAB", rsaE)
+	}
+}
+
+func TestGetJwksNotLoaded(t *testing.T) {
+	defaultKeyring = nil
+	if keys := GetJwks().Keys; keys == nil || len(keys) != 0 {
+		t.Errorf("GetJwks without a keyring = %v, want an empty list", keys)
+	}
+}
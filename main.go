@@ -2,10 +2,28 @@ package main
 
 import (
 	"example/aibooks-backend/config"
+	"example/aibooks-backend/email"
+	"example/aibooks-backend/keyring"
+	"example/aibooks-backend/models/accesstokens"
+	"example/aibooks-backend/models/accountdeletions"
+	"example/aibooks-backend/models/activities"
+	"example/aibooks-backend/models/auditlogs"
+	"example/aibooks-backend/models/blocks"
+	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/models/dataexports"
+	"example/aibooks-backend/models/emailoutbox"
+	"example/aibooks-backend/models/follows"
+	"example/aibooks-backend/models/loginattempts"
+	"example/aibooks-backend/models/otps"
+	"example/aibooks-backend/models/refreshtokens"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/models/usersessions"
 	"example/aibooks-backend/routes"
+	"example/aibooks-backend/storage"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/sessions"
@@ -24,9 +42,49 @@ func main() {
 		log.Println("Running in PROD mode.")
 	}
 
+	if err := keyring.Load(); err != nil {
+		log.Fatalln("Failed to load JWT keys:", err)
+	}
+
+	if err := email.Load(); err != nil {
+		log.Fatalln("Failed to configure email:", err)
+	}
+
+	if err := storage.Load(); err != nil {
+		log.Fatalln("Failed to configure blob storage:", err)
+	}
+
 	disconnectMongoDB := config.ConnectMongoDB()
 	defer disconnectMongoDB()
 
+	// #region Indexes
+	indexCreators := []func() error{
+		users.CreateIndexes,
+		auditlogs.CreateIndexes,
+		books.CreateIndexes,
+		books.CreateBookIndexes,
+		otps.CreateIndexes,
+		loginattempts.CreateIndexes,
+		accesstokens.CreateIndexes,
+		refreshtokens.CreateIndexes,
+		usersessions.CreateIndexes,
+		dataexports.CreateIndexes,
+		emailoutbox.CreateIndexes,
+		follows.CreateIndexes,
+		activities.CreateIndexes,
+		blocks.CreateIndexes,
+	}
+	for _, createIndexes := range indexCreators {
+		if err := createIndexes(); err != nil {
+			log.Fatalln("Failed to create indexes:", err)
+		}
+	}
+	// #endregion
+
+	accountdeletions.StartPurgeWorker(time.Hour)
+	dataexports.StartCleanupWorker(time.Hour)
+	emailoutbox.StartWorker(10 * time.Second)
+
 	ginMode := os.Getenv("GIN_MODE")
 	gin.SetMode(ginMode)
 	frontendProd := os.Getenv("FRONTEND_PROD_URL")
@@ -36,8 +94,8 @@ func main() {
 	// #region CORS
 	corsConfigs := cors.Config{
 		AllowOrigins:     []string{frontendProd, frontendDev},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Accept", "Origin", "X-Requested-With"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Content-Type", "Accept", "Origin", "X-Requested-With", "Authorization", "X-CSRF-Token"},
 		AllowCredentials: true, // Only works with specific origins, not "*"
 	}
 	router.Use(cors.New(corsConfigs))
@@ -1,37 +1,138 @@
 package middleware
 
 import (
-	"os"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/keyring"
+	"example/aibooks-backend/models/accesstokens"
+	"example/aibooks-backend/models/usersessions"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 )
 
+// authFailure is the response for credentials that were rejected.
+type authFailure struct {
+	status int
+	body   gin.H
+}
+
+var (
+	errMissingToken   = &authFailure{401, gin.H{"message": "Failed to retrieve token."}}
+	errInvalidToken   = &authFailure{401, gin.H{"message": "Invalid token"}}
+	errExpiredToken   = &authFailure{401, gin.H{"message": "Token expired.", "code": "TOKEN_EXPIRED"}}
+	errRevokedSession = &authFailure{401, gin.H{"message": "Session has been revoked.", "code": "SESSION_REVOKED"}}
+	errAuthInternal   = &authFailure{500, gin.H{"message": "Uh oh! Something went wrong."}}
+)
+
+// IsAuthenticated accepts either the auth-token cookie or a personal access token
+// in an Authorization: Bearer header.
 func IsAuthenticated(c *gin.Context) {
-	tokenString, err := c.Cookie("auth-token")
-	if err != nil {
-		c.IndentedJSON(401, gin.H{"message": "Failed to retrieve token."})
+	if failure := authenticate(c); failure != nil {
+		c.IndentedJSON(failure.status, failure.body)
 		c.Abort()
 		return
 	}
+	c.Next()
+}
+
+// AuthenticateIf applies IsAuthenticated to requests match returns true for and lets
+// the others through without looking at their credentials.
+func AuthenticateIf(match func(c *gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if match(c) {
+			IsAuthenticated(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// OptionalAuthentication sets the same context as IsAuthenticated when the request
+// carries valid credentials. Missing, expired, revoked or otherwise invalid ones are
+// ignored and the request goes through as anonymous without a user_id.
+func OptionalAuthentication(c *gin.Context) {
+	authenticate(c)
+	c.Next()
+}
+
+// authenticate checks the request's credentials and, only if they are valid, sets
+// user_id and the rest of the auth context.
+func authenticate(c *gin.Context) *authFailure {
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		return authenticateAccessToken(c, authHeader)
+	}
+
+	tokenString, err := c.Cookie("auth-token")
+	if err != nil || tokenString == "" {
+		return errMissingToken
+	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	token, err := keyring.Parse(tokenString)
+	if validationErr, ok := err.(*jwt.ValidationError); ok && validationErr.Errors == jwt.ValidationErrorExpired {
+		// Clients should call /auth/refresh when they see this code
+		return errExpiredToken
+	} else if err != nil {
+		return errMissingToken
+	}
+
+	// Tokens with a purpose (mfa, magic link) are signed by the same keyring but are not access tokens
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != nil {
+		return errInvalidToken
+	}
+
+	// Tokens issued before expiry was introduced carry no exp and are no longer accepted
+	userId, ok := claims["user_id"].(string)
+	if !ok || !claims.VerifyExpiresAt(0, true) {
+		return errInvalidToken
+	}
+
+	sessionId, _ := claims["sid"].(string)
+	active, err := usersessions.IsSessionActive(sessionId, userId)
 	if err != nil {
-		c.IndentedJSON(401, gin.H{"message": "Failed to retrieve token."})
-		c.Abort()
-		return
+		return errAuthInternal
+	}
+	if !active {
+		return errRevokedSession
 	}
+	usersessions.TouchSession(sessionId, c.ClientIP())
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userId := claims["user_id"].(string)
-		c.Set("user_id", userId)
-	} else {
-		c.IndentedJSON(401, gin.H{"message": "Invalid token"})
-		c.Abort()
-		return
+	var roles []string
+	if rawRoles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range rawRoles {
+			if r, ok := role.(string); ok {
+				roles = append(roles, r)
+			}
+		}
 	}
 
-	c.Next()
+	c.Set("user_id", userId)
+	c.Set("session_id", sessionId)
+	c.Set("roles", roles)
+	return nil
+}
+
+// authenticateAccessToken handles personal access tokens. They carry scopes instead
+// of roles, so they never pass RequireRole and are limited by RequireScope.
+func authenticateAccessToken(c *gin.Context, authHeader string) *authFailure {
+	raw, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || !strings.HasPrefix(raw, accesstokens.TokenPrefix) {
+		return errInvalidToken
+	}
+
+	token, err := accesstokens.GetValidAccessToken(raw)
+	if err == errorHandling.ErrTokenExpired {
+		return errExpiredToken
+	} else if err == errorHandling.ErrInvalidToken {
+		return errInvalidToken
+	} else if err != nil {
+		return errAuthInternal
+	}
+	accesstokens.TouchAccessToken(token.Id)
+
+	c.Set("user_id", token.UserId.Hex())
+	c.Set("access_token_id", token.Id.Hex())
+	c.Set("scopes", token.Scopes)
+	return nil
 }
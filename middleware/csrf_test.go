@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCsrfProtect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(CsrfProtect)
+	router.Any("/", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		cookie        string
+		header        string
+		authorization string
+		want          int
+	}{
+		{name: "GET", method: http.MethodGet, want: http.StatusNoContent},
+		{name: "HEAD", method: http.MethodHead, want: http.StatusNoContent},
+		{name: "OPTIONS", method: http.MethodOptions, want: http.StatusNoContent},
+		{name: "bearer token", method: http.MethodPost, authorization: "Bearer abc", want: http.StatusNoContent},
+		{name: "basic auth is not exempt", method: http.MethodPost, authorization: "Basic abc", want: http.StatusForbidden},
+		{name: "missing cookie", method: http.MethodPost, header: "token", want: http.StatusForbidden},
+		{name: "missing header", method: http.MethodPost, cookie: "token", want: http.StatusForbidden},
+		{name: "mismatch", method: http.MethodPost, cookie: "token", header: "other", want: http.StatusForbidden},
+		{name: "match", method: http.MethodPost, cookie: "token", header: "token", want: http.StatusNoContent},
+		{name: "match on DELETE", method: http.MethodDelete, cookie: "token", header: "token", want: http.StatusNoContent},
+		{name: "mismatch on PATCH", method: http.MethodPatch, cookie: "token", header: "other", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CsrfCookieName, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(CsrfHeaderName, tt.header)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusForbidden && !strings.Contains(w.Body.String(), "CSRF_INVALID") {
+				t.Errorf("body = %s, want the CSRF_INVALID code", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets requests through when the authenticated user has at least
+// one of the given roles. It must run after IsAuthenticated.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userRoles := c.GetStringSlice("roles")
+
+		for _, role := range roles {
+			if slices.Contains(userRoles, role) {
+				c.Next()
+				return
+			}
+		}
+
+		c.IndentedJSON(403, gin.H{"message": "You do not have permission to do that."})
+		c.Abort()
+	}
+}
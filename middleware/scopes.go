@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope checks personal access tokens for the given scope. Cookie sessions
+// have full access and always pass. It must run after IsAuthenticated.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("access_token_id") == "" || slices.Contains(c.GetStringSlice("scopes"), scope) {
+			c.Next()
+			return
+		}
+
+		c.IndentedJSON(403, gin.H{"message": "Token is missing the " + scope + " scope."})
+		c.Abort()
+	}
+}
+
+// RequireSession rejects personal access tokens, for routes that manage the account itself.
+func RequireSession(c *gin.Context) {
+	if c.GetString("access_token_id") != "" {
+		c.IndentedJSON(403, gin.H{"message": "This route can't be used with an access token."})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
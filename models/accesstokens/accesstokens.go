@@ -0,0 +1,233 @@
+package accesstokens
+
+import (
+	"context"
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AccessToken is a personal access token used by scripts through an Authorization: Bearer header.
+type AccessToken struct {
+	Id         primitive.ObjectID  `bson:"_id" json:"id"`
+	UserId     primitive.ObjectID  `bson:"userId" json:"userId"`
+	Name       string              `bson:"name" json:"name"`
+	Scopes     []string            `bson:"scopes" json:"scopes"`
+	TokenHash  string              `bson:"tokenHash" json:"-"`
+	Prefix     string              `bson:"prefix" json:"prefix"`
+	ExpiresAt  *primitive.DateTime `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt *primitive.DateTime `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	CreatedAt  primitive.DateTime  `bson:"createdAt" json:"createdAt"`
+}
+
+const (
+	ScopeBooksRead    = "books:read"
+	ScopeRatingsWrite = "ratings:write"
+	ScopeLibraryRead  = "library:read"
+	ScopeLibraryWrite = "library:write"
+	ScopeProfileRead  = "profile:read"
+)
+
+var ValidScopes = []string{ScopeBooksRead, ScopeRatingsWrite, ScopeLibraryRead, ScopeLibraryWrite, ScopeProfileRead}
+
+// TokenPrefix marks personal access tokens so they are easy to spot in logs and secret scanners.
+const TokenPrefix = "aib_"
+
+var AccessTokensCollectionName string = "accesstokens"
+var AccessTokensCollection *mongo.Collection
+
+// lastUsedInterval limits how often a token's lastUsedAt is written.
+var lastUsedInterval = time.Minute
+
+func CreateIndexes() error {
+	if AccessTokensCollection == nil {
+		AccessTokensCollection = config.GetCollection(AccessTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := AccessTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+// CreateAccessToken stores a new token and returns it together with the raw token, which is never stored.
+func CreateAccessToken(userId primitive.ObjectID, name string, scopes []string, expiresAt *time.Time) (AccessToken, string, error) {
+	if AccessTokensCollection == nil {
+		AccessTokensCollection = config.GetCollection(AccessTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	var token AccessToken
+	random, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return token, "", errorHandling.NewAPIError(500, CreateAccessToken, err.Error())
+	}
+	raw := TokenPrefix + random
+
+	token = AccessToken{
+		Id:        primitive.NewObjectID(),
+		UserId:    userId,
+		Name:      name,
+		Scopes:    scopes,
+		TokenHash: utils.HashToken(raw),
+		Prefix:    raw[:len(TokenPrefix)+6],
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+	if expiresAt != nil {
+		dt := primitive.NewDateTimeFromTime(*expiresAt)
+		token.ExpiresAt = &dt
+	}
+
+	_, err = AccessTokensCollection.InsertOne(ctx, token)
+	if err != nil {
+		return token, "", errorHandling.NewAPIError(500, CreateAccessToken, err.Error())
+	}
+	return token, raw, nil
+}
+
+// GetValidAccessToken looks up a raw token and returns it if it exists and has not expired.
+func GetValidAccessToken(raw string) (AccessToken, error) {
+	if AccessTokensCollection == nil {
+		AccessTokensCollection = config.GetCollection(AccessTokensCollectionName)
+	}
+
+	var token AccessToken
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	err := AccessTokensCollection.FindOne(ctx, bson.M{"tokenHash": utils.HashToken(raw)}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return token, errorHandling.ErrInvalidToken
+	} else if err != nil {
+		return token, errorHandling.NewAPIError(500, GetValidAccessToken, err.Error())
+	}
+
+	if token.ExpiresAt != nil && token.ExpiresAt.Time().Before(time.Now()) {
+		return token, errorHandling.ErrTokenExpired
+	}
+
+	return token, nil
+}
+
+func TouchAccessToken(id primitive.ObjectID) error {
+	if AccessTokensCollection == nil {
+		AccessTokensCollection = config.GetCollection(AccessTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	now := time.Now()
+	_, err := AccessTokensCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "$or": []bson.M{
+			{"lastUsedAt": bson.M{"$exists": false}},
+			{"lastUsedAt": bson.M{"$lt": primitive.NewDateTimeFromTime(now.Add(-lastUsedInterval))}},
+		}},
+		bson.M{"$set": bson.M{"lastUsedAt": primitive.NewDateTimeFromTime(now)}},
+	)
+	if err != nil {
+		return errorHandling.NewAPIError(500, TouchAccessToken, err.Error())
+	}
+	return nil
+}
+
+func GetAccessTokensByUserId(userId string) ([]AccessToken, error) {
+	if AccessTokensCollection == nil {
+		AccessTokensCollection = config.GetCollection(AccessTokensCollectionName)
+	}
+
+	tokens := []AccessToken{}
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	userIdObj, err := primitive.ObjectIDFromHex(userId)
+	if err == primitive.ErrInvalidHex {
+		return tokens, errorHandling.NewAPIError(400, GetAccessTokensByUserId, "Invalid user id")
+	} else if err != nil {
+		return tokens, errorHandling.NewAPIError(500, GetAccessTokensByUserId, err.Error())
+	}
+
+	cursor, err := AccessTokensCollection.Find(ctx, bson.M{"userId": userIdObj}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return tokens, errorHandling.NewAPIError(500, GetAccessTokensByUserId, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return tokens, errorHandling.NewAPIError(500, GetAccessTokensByUserId, err.Error())
+	}
+	return tokens, nil
+}
+
+func DeleteAccessToken(id string, userId string) error {
+	if AccessTokensCollection == nil {
+		AccessTokensCollection = config.GetCollection(AccessTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err == primitive.ErrInvalidHex {
+		return errorHandling.NewAPIError(400, DeleteAccessToken, "Invalid token id")
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, DeleteAccessToken, err.Error())
+	}
+
+	userIdObj, err := primitive.ObjectIDFromHex(userId)
+	if err == primitive.ErrInvalidHex {
+		return errorHandling.NewAPIError(400, DeleteAccessToken, "Invalid user id")
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, DeleteAccessToken, err.Error())
+	}
+
+	result, err := AccessTokensCollection.DeleteOne(ctx, bson.M{"_id": idObj, "userId": userIdObj})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteAccessToken, err.Error())
+	}
+	if result.DeletedCount == 0 {
+		return errorHandling.NewAPIError(404, DeleteAccessToken, "Token not found")
+	}
+	return nil
+}
+
+func DeleteAccessTokensByUserId(ctx context.Context, userId primitive.ObjectID) error {
+	if AccessTokensCollection == nil {
+		AccessTokensCollection = config.GetCollection(AccessTokensCollectionName)
+	}
+
+	_, err := AccessTokensCollection.DeleteMany(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteAccessTokensByUserId, err.Error())
+	}
+	return nil
+}
+
+// RevokeAllByUserId deletes every personal access token of the user, for when all of
+// their credentials have to stop working at once.
+func RevokeAllByUserId(userId primitive.ObjectID) error {
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	return DeleteAccessTokensByUserId(ctx, userId)
+}
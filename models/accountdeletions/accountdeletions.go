@@ -0,0 +1,129 @@
+package accountdeletions
+
+import (
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/accesstokens"
+	"example/aibooks-backend/models/activities"
+	"example/aibooks-backend/models/auditlogs"
+	"example/aibooks-backend/models/avatars"
+	"example/aibooks-backend/models/blocks"
+	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/models/dataexports"
+	"example/aibooks-backend/models/follows"
+	"example/aibooks-backend/models/otps"
+	"example/aibooks-backend/models/refreshtokens"
+	"example/aibooks-backend/models/userlibrarys"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/models/usersessions"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DeleteAccount removes the user and everything that belongs to them in one transaction.
+// The last admin is never deleted.
+func DeleteAccount(user users.Users) error {
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	client := config.GetDB().Client()
+	session, err := client.StartSession()
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteAccount, "Failed to start session")
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := users.GuardLastAdmin(sessCtx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := books.DeleteRatingsByUserId(sessCtx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := userlibrarys.DeleteLibraryByUserId(sessCtx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := activities.DeleteActivitiesByActorId(sessCtx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := follows.DeleteFollowsByUserId(sessCtx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := blocks.DeleteBlocksByUserId(sessCtx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := otps.DeleteOtpsByEmail(sessCtx, user.Email); err != nil {
+			return nil, err
+		}
+		if user.PendingEmail != "" {
+			if err := otps.DeleteOtpsByEmail(sessCtx, user.PendingEmail); err != nil {
+				return nil, err
+			}
+		}
+		if err := usersessions.DeleteSessionsByUserId(sessCtx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := refreshtokens.DeleteByUserId(sessCtx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := accesstokens.DeleteAccessTokensByUserId(sessCtx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := users.DeleteUserById(sessCtx, user.Id); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+	if _, ok := err.(errorHandling.APIError); ok {
+		return err
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, DeleteAccount, err.Error())
+	}
+
+	// GridFS files can't be removed inside the transaction, the account is gone either way
+	if err := dataexports.DeleteExportsByUserId(user.Id); err != nil {
+		log.Println("Failed to delete data exports of", user.Id.Hex(), err)
+	}
+	if user.AvatarFileId != nil {
+		if err := avatars.DeleteAvatar(*user.AvatarFileId); err != nil {
+			log.Println("Failed to delete avatar of", user.Id.Hex(), err)
+		}
+	}
+
+	if err := auditlogs.AddAuditLog(auditlogs.AuditLog{
+		ActorId:    user.Id,
+		Action:     "user.deleted",
+		TargetType: "user",
+		TargetId:   user.Id,
+	}); err != nil {
+		log.Println("Failed to write audit log for deletion of", user.Id.Hex(), err)
+	}
+	return nil
+}
+
+// PurgeScheduledDeletions deletes accounts whose grace period has ended.
+func PurgeScheduledDeletions() {
+	dueUsers, err := users.GetUsersDueForDeletion(100)
+	if err != nil {
+		log.Println("Failed to load accounts due for deletion:", err)
+		return
+	}
+
+	for _, user := range dueUsers {
+		if err := DeleteAccount(user); err != nil {
+			log.Println("Failed to delete account", user.Id.Hex(), err)
+		}
+	}
+}
+
+// StartPurgeWorker runs PurgeScheduledDeletions every interval until the process exits.
+func StartPurgeWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			PurgeScheduledDeletions()
+		}
+	}()
+}
@@ -0,0 +1,271 @@
+package activities
+
+import (
+	"bytes"
+	"context"
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/config/imageconfigs"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/blocks"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Activities are written when they happen and read per follower (fan-out on read).
+// Feeds page by _id, which is time ordered. Mongo only merges the {actorId, type, _id}
+// index ranges of a $in into a sorted result for up to 200 ranges, so GetFeed asks for
+// followed users in chunks of feedChunkSize and merges the chunks itself.
+type Activity struct {
+	Id        primitive.ObjectID  `bson:"_id" json:"id"`
+	ActorId   primitive.ObjectID  `bson:"actorId" json:"actorId"`
+	Type      string              `bson:"type" json:"type"`
+	BookId    primitive.ObjectID  `bson:"bookId" json:"bookId"`
+	RatingId  *primitive.ObjectID `bson:"ratingId,omitempty" json:"ratingId,omitempty"`
+	Rating    int                 `bson:"rating,omitempty" json:"rating,omitempty"`
+	Review    string              `bson:"review,omitempty" json:"review,omitempty"`
+	CreatedAt primitive.DateTime  `bson:"createdAt" json:"createdAt"`
+}
+
+const (
+	TypeRated        = "rated"
+	TypeLibraryAdded = "library_added"
+	TypeFinished     = "finished"
+)
+
+// LibraryTypes are the activity types covered by a user's library privacy setting.
+var LibraryTypes = []string{TypeLibraryAdded, TypeFinished}
+
+// FeedBook is the part of a book shown in a feed item.
+type FeedBook struct {
+	Id                 primitive.ObjectID             `bson:"_id"`
+	Title              string                         `bson:"title"`
+	Genre              []string                       `bson:"genre"`
+	CoverImageUrl      string                         `bson:"coverImageUrl"`
+	CoverImagePublicId string                         `bson:"coverImagePublicId"`
+	CoverImageWidth    *imageconfigs.ImageWidthHeight `bson:"coverImageWidth"`
+	CoverImageHeight   *imageconfigs.ImageWidthHeight `bson:"coverImageHeight"`
+	CoverImageVariants *imageconfigs.CoverVariants    `bson:"coverImageVariants"`
+}
+
+type FeedItem struct {
+	Activity `bson:",inline"`
+	Book     FeedBook `bson:"book"`
+}
+
+var ActivitiesCollectionName string = "activities"
+var ActivitiesCollection *mongo.Collection
+
+func CreateIndexes() error {
+	if ActivitiesCollection == nil {
+		ActivitiesCollection = config.GetCollection(ActivitiesCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := ActivitiesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "type", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "bookId", Value: 1}, {Key: "type", Value: 1}}},
+		{Keys: bson.D{{Key: "bookId", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "ratingId", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+// RecordActivity stores an activity. It takes the caller's context so it can be part
+// of the transaction that made the change.
+func RecordActivity(ctx context.Context, activity Activity) error {
+	if ActivitiesCollection == nil {
+		ActivitiesCollection = config.GetCollection(ActivitiesCollectionName)
+	}
+
+	activity.Id = primitive.NewObjectID()
+	activity.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	_, err := ActivitiesCollection.InsertOne(ctx, activity)
+	if err != nil {
+		return errorHandling.NewAPIError(500, RecordActivity, err.Error())
+	}
+	return nil
+}
+
+// UpdateRatingActivity keeps the rating shown in the feed in sync when a rating is
+// edited, without moving it back to the top.
+func UpdateRatingActivity(ctx context.Context, ratingId primitive.ObjectID, rating int, review string) error {
+	if ActivitiesCollection == nil {
+		ActivitiesCollection = config.GetCollection(ActivitiesCollectionName)
+	}
+
+	_, err := ActivitiesCollection.UpdateMany(ctx, bson.M{"ratingId": ratingId}, bson.M{
+		"$set": bson.M{"rating": rating, "review": review},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, UpdateRatingActivity, err.Error())
+	}
+	return nil
+}
+
+func DeleteRatingActivity(ctx context.Context, ratingId primitive.ObjectID) error {
+	if ActivitiesCollection == nil {
+		ActivitiesCollection = config.GetCollection(ActivitiesCollectionName)
+	}
+
+	_, err := ActivitiesCollection.DeleteMany(ctx, bson.M{"ratingId": ratingId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteRatingActivity, err.Error())
+	}
+	return nil
+}
+
+// DeleteBookActivities removes the actor's activities of the given types for a book,
+// e.g. when it is taken out of their library.
+func DeleteBookActivities(ctx context.Context, actorId primitive.ObjectID, bookId primitive.ObjectID, types []string) error {
+	if ActivitiesCollection == nil {
+		ActivitiesCollection = config.GetCollection(ActivitiesCollectionName)
+	}
+
+	_, err := ActivitiesCollection.DeleteMany(ctx, bson.M{
+		"actorId": actorId,
+		"bookId":  bookId,
+		"type":    bson.M{"$in": types},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteBookActivities, err.Error())
+	}
+	return nil
+}
+
+func DeleteActivitiesByActorId(ctx context.Context, actorId primitive.ObjectID) error {
+	if ActivitiesCollection == nil {
+		ActivitiesCollection = config.GetCollection(ActivitiesCollectionName)
+	}
+
+	_, err := ActivitiesCollection.DeleteMany(ctx, bson.M{"actorId": actorId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteActivitiesByActorId, err.Error())
+	}
+	return nil
+}
+
+// DeleteActivitiesByBookId removes every activity about a deleted book.
+func DeleteActivitiesByBookId(ctx context.Context, bookId primitive.ObjectID) error {
+	if ActivitiesCollection == nil {
+		ActivitiesCollection = config.GetCollection(ActivitiesCollectionName)
+	}
+
+	_, err := ActivitiesCollection.DeleteMany(ctx, bson.M{"bookId": bookId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteActivitiesByBookId, err.Error())
+	}
+	return nil
+}
+
+// feedChunkSize keeps each feed query below Mongo's limit of 200 index ranges it will
+// merge for a sort. Library activities use two ranges per actor.
+const feedChunkSize = 60
+
+// GetFeed returns up to limit activities older than before (or the newest if before is
+// nil), newest first. Rating activities only come from ratingActorIds and library
+// activities only from libraryActorIds, so callers apply privacy by choosing the ids.
+// Users viewerId muted or blocked, or who blocked viewerId, are always left out.
+//
+// Every chunk of actors returns its own newest limit ids, the newest limit of all of
+// them make up the page.
+func GetFeed(viewerId primitive.ObjectID, ratingActorIds []primitive.ObjectID, libraryActorIds []primitive.ObjectID, before primitive.ObjectID, limit int64) ([]FeedItem, error) {
+	if ActivitiesCollection == nil {
+		ActivitiesCollection = config.GetCollection(ActivitiesCollectionName)
+	}
+
+	items := []FeedItem{}
+	hiddenIds, err := blocks.GetHiddenUserIds(viewerId)
+	if err != nil {
+		return items, err
+	}
+	isHidden := func(id primitive.ObjectID) bool { return slices.Contains(hiddenIds, id) }
+	ratingActorIds = slices.DeleteFunc(slices.Clone(ratingActorIds), isHidden)
+	libraryActorIds = slices.DeleteFunc(slices.Clone(libraryActorIds), isHidden)
+	if len(ratingActorIds) == 0 && len(libraryActorIds) == 0 {
+		return items, nil
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	var filters []bson.M
+	for chunk := range slices.Chunk(ratingActorIds, feedChunkSize) {
+		filters = append(filters, bson.M{"actorId": bson.M{"$in": chunk}, "type": TypeRated})
+	}
+	for chunk := range slices.Chunk(libraryActorIds, feedChunkSize) {
+		filters = append(filters, bson.M{"actorId": bson.M{"$in": chunk}, "type": bson.M{"$in": LibraryTypes}})
+	}
+
+	opts := options.Find().
+		SetSort(bson.M{"_id": -1}).
+		SetLimit(limit).
+		SetProjection(bson.M{"_id": 1})
+
+	var ids []primitive.ObjectID
+	for _, filter := range filters {
+		if !before.IsZero() {
+			filter["_id"] = bson.M{"$lt": before}
+		}
+
+		cursor, err := ActivitiesCollection.Find(ctx, filter, opts)
+		if err != nil {
+			return items, errorHandling.NewAPIError(500, GetFeed, err.Error())
+		}
+		var chunkIds []struct {
+			Id primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &chunkIds); err != nil {
+			return items, errorHandling.NewAPIError(500, GetFeed, err.Error())
+		}
+		for _, chunkId := range chunkIds {
+			ids = append(ids, chunkId.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return items, nil
+	}
+
+	// ObjectIDs start with their creation time, so comparing bytes orders them by age
+	slices.SortFunc(ids, func(a, b primitive.ObjectID) int { return bytes.Compare(b[:], a[:]) })
+	ids = ids[:min(int64(len(ids)), limit)]
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"_id": bson.M{"$in": ids}}},
+		{"$sort": bson.M{"_id": -1}},
+		{
+			"$lookup": bson.M{
+				"from":         "bookdatas",
+				"localField":   "bookId",
+				"foreignField": "_id",
+				"as":           "book",
+			},
+		},
+		// Books removed since are kept as an empty book so callers can still page past them
+		{"$unwind": bson.M{"path": "$book", "preserveNullAndEmptyArrays": true}},
+	}
+
+	cursor, err := ActivitiesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return items, errorHandling.NewAPIError(500, GetFeed, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &items); err != nil {
+		return items, errorHandling.NewAPIError(500, GetFeed, err.Error())
+	}
+	return items, nil
+}
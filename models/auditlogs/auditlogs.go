@@ -0,0 +1,62 @@
+package auditlogs
+
+import (
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AuditLog struct {
+	Id         primitive.ObjectID `bson:"_id" json:"id"`
+	ActorId    primitive.ObjectID `bson:"actorId" json:"actorId"`
+	Action     string             `bson:"action" json:"action"`
+	TargetType string             `bson:"targetType" json:"targetType"`
+	TargetId   primitive.ObjectID `bson:"targetId" json:"targetId"`
+	Ip         string             `bson:"ip" json:"ip"`
+	UserAgent  string             `bson:"userAgent" json:"userAgent"`
+	Details    bson.M             `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt  primitive.DateTime `bson:"createdAt" json:"createdAt"`
+}
+
+var AuditLogsCollectionName string = "auditlogs"
+var AuditLogsCollection *mongo.Collection
+
+func CreateIndexes() error {
+	if AuditLogsCollection == nil {
+		AuditLogsCollection = config.GetCollection(AuditLogsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := AuditLogsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "targetType", Value: 1}, {Key: "targetId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+func AddAuditLog(log AuditLog) error {
+	if AuditLogsCollection == nil {
+		AuditLogsCollection = config.GetCollection(AuditLogsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	log.Id = primitive.NewObjectID()
+	log.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	_, err := AuditLogsCollection.InsertOne(ctx, log)
+	if err != nil {
+		return errorHandling.NewAPIError(500, AddAuditLog, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package avatars
+
+import (
+	"bytes"
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"io"
+	"net/http"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Avatars are stored in the "avatars" GridFS bucket with their content type in the
+// file metadata.
+
+const MaxAvatarSize = 2 << 20
+
+var AllowedContentTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+var AvatarsBucketName string = "avatars"
+
+func getBucket() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(config.GetDB(), options.GridFSBucket().SetName(AvatarsBucketName))
+}
+
+// SaveAvatar validates the image by size and sniffed content type and stores it.
+func SaveAvatar(userId primitive.ObjectID, data []byte) (primitive.ObjectID, error) {
+	if len(data) > MaxAvatarSize {
+		return primitive.NilObjectID, errorHandling.NewAPIError(413, SaveAvatar, "Avatar too large")
+	}
+
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(AllowedContentTypes, contentType) {
+		return primitive.NilObjectID, errorHandling.NewAPIError(415, SaveAvatar, "Unsupported avatar type")
+	}
+
+	bucket, err := getBucket()
+	if err != nil {
+		return primitive.NilObjectID, errorHandling.NewAPIError(500, SaveAvatar, err.Error())
+	}
+
+	opts := options.GridFSUpload().SetMetadata(bson.M{"userId": userId, "contentType": contentType})
+	fileId, err := bucket.UploadFromStream(userId.Hex(), bytes.NewReader(data), opts)
+	if err != nil {
+		return primitive.NilObjectID, errorHandling.NewAPIError(500, SaveAvatar, err.Error())
+	}
+	return fileId, nil
+}
+
+// DownloadAvatar writes the avatar to w and returns its content type.
+func DownloadAvatar(fileId primitive.ObjectID, w io.Writer) (string, error) {
+	bucket, err := getBucket()
+	if err != nil {
+		return "", errorHandling.NewAPIError(500, DownloadAvatar, err.Error())
+	}
+
+	stream, err := bucket.OpenDownloadStream(fileId)
+	if err == gridfs.ErrFileNotFound {
+		return "", errorHandling.NewAPIError(404, DownloadAvatar, "Avatar not found")
+	} else if err != nil {
+		return "", errorHandling.NewAPIError(500, DownloadAvatar, err.Error())
+	}
+	defer stream.Close()
+
+	var metadata struct {
+		ContentType string `bson:"contentType"`
+	}
+	if raw := stream.GetFile().Metadata; raw != nil {
+		bson.Unmarshal(raw, &metadata)
+	}
+
+	if _, err := io.Copy(w, stream); err != nil {
+		return "", errorHandling.NewAPIError(500, DownloadAvatar, err.Error())
+	}
+	return metadata.ContentType, nil
+}
+
+func DeleteAvatar(fileId primitive.ObjectID) error {
+	bucket, err := getBucket()
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteAvatar, err.Error())
+	}
+
+	if err := bucket.Delete(fileId); err != nil && err != gridfs.ErrFileNotFound {
+		return errorHandling.NewAPIError(500, DeleteAvatar, err.Error())
+	}
+	return nil
+}
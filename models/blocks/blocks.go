@@ -0,0 +1,206 @@
+package blocks
+
+import (
+	"context"
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A mute hides the target's reviews and activity from the user. A block does the
+// same in both directions and also stops the target from following the user or
+// seeing more than their public card.
+type Block struct {
+	Id        primitive.ObjectID `bson:"_id" json:"id"`
+	UserId    primitive.ObjectID `bson:"userId" json:"userId"`
+	TargetId  primitive.ObjectID `bson:"targetId" json:"targetId"`
+	Kind      string             `bson:"kind" json:"kind"`
+	CreatedAt primitive.DateTime `bson:"createdAt" json:"createdAt"`
+}
+
+const (
+	KindBlock = "block"
+	KindMute  = "mute"
+)
+
+// MaxEntries caps each list, which bounds the $nin hidden users add to queries.
+const MaxEntries = 1000
+
+var BlocksCollectionName string = "userblocks"
+var BlocksCollection *mongo.Collection
+
+func CreateIndexes() error {
+	if BlocksCollection == nil {
+		BlocksCollection = config.GetCollection(BlocksCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := BlocksCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "targetId", Value: 1}, {Key: "kind", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "targetId", Value: 1}, {Key: "kind", Value: 1}}},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+// AddEntry blocks or mutes targetId for userId. Adding an existing entry is a no-op.
+func AddEntry(userId primitive.ObjectID, targetId primitive.ObjectID, kind string) error {
+	if BlocksCollection == nil {
+		BlocksCollection = config.GetCollection(BlocksCollectionName)
+	}
+
+	if userId == targetId {
+		return errorHandling.NewAPIError(400, AddEntry, "Cannot "+kind+" yourself")
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	count, err := BlocksCollection.CountDocuments(ctx, bson.M{"userId": userId, "kind": kind})
+	if err != nil {
+		return errorHandling.NewAPIError(500, AddEntry, err.Error())
+	}
+	if count >= MaxEntries {
+		return errorHandling.NewAPIError(409, AddEntry, "List is full")
+	}
+
+	_, err = BlocksCollection.UpdateOne(ctx,
+		bson.M{"userId": userId, "targetId": targetId, "kind": kind},
+		bson.M{"$setOnInsert": bson.M{
+			"_id":       primitive.NewObjectID(),
+			"createdAt": primitive.NewDateTimeFromTime(time.Now()),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return errorHandling.NewAPIError(500, AddEntry, err.Error())
+	}
+	return nil
+}
+
+func RemoveEntry(userId primitive.ObjectID, targetId primitive.ObjectID, kind string) error {
+	if BlocksCollection == nil {
+		BlocksCollection = config.GetCollection(BlocksCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := BlocksCollection.DeleteOne(ctx, bson.M{"userId": userId, "targetId": targetId, "kind": kind})
+	if err != nil {
+		return errorHandling.NewAPIError(500, RemoveEntry, err.Error())
+	}
+	return nil
+}
+
+func GetEntries(userId primitive.ObjectID, kind string) ([]Block, error) {
+	if BlocksCollection == nil {
+		BlocksCollection = config.GetCollection(BlocksCollectionName)
+	}
+
+	entries := []Block{}
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"_id": -1})
+	cursor, err := BlocksCollection.Find(ctx, bson.M{"userId": userId, "kind": kind}, opts)
+	if err != nil {
+		return entries, errorHandling.NewAPIError(500, GetEntries, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &entries); err != nil {
+		return entries, errorHandling.NewAPIError(500, GetEntries, err.Error())
+	}
+	return entries, nil
+}
+
+// IsBlocked reports whether userId has blocked targetId.
+func IsBlocked(userId primitive.ObjectID, targetId primitive.ObjectID) (bool, error) {
+	if BlocksCollection == nil {
+		BlocksCollection = config.GetCollection(BlocksCollectionName)
+	}
+
+	if userId.IsZero() || targetId.IsZero() {
+		return false, nil
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	count, err := BlocksCollection.CountDocuments(ctx,
+		bson.M{"userId": userId, "targetId": targetId, "kind": KindBlock},
+		options.Count().SetLimit(1),
+	)
+	if err != nil {
+		return false, errorHandling.NewAPIError(500, IsBlocked, err.Error())
+	}
+	return count > 0, nil
+}
+
+// GetHiddenUserIds returns the users whose content must not be shown to viewerId:
+// everyone they muted or blocked and everyone who blocked them. Anonymous viewers
+// have nobody hidden.
+func GetHiddenUserIds(viewerId primitive.ObjectID) ([]primitive.ObjectID, error) {
+	if BlocksCollection == nil {
+		BlocksCollection = config.GetCollection(BlocksCollectionName)
+	}
+
+	ids := []primitive.ObjectID{}
+	if viewerId.IsZero() {
+		return ids, nil
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	cursor, err := BlocksCollection.Find(ctx, bson.M{"$or": []bson.M{
+		{"userId": viewerId},
+		{"targetId": viewerId, "kind": KindBlock},
+	}})
+	if err != nil {
+		return ids, errorHandling.NewAPIError(500, GetHiddenUserIds, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	var entries []Block
+	if err := cursor.All(ctx, &entries); err != nil {
+		return ids, errorHandling.NewAPIError(500, GetHiddenUserIds, err.Error())
+	}
+	for _, entry := range entries {
+		if entry.UserId == viewerId {
+			ids = append(ids, entry.TargetId)
+		} else {
+			ids = append(ids, entry.UserId)
+		}
+	}
+	return ids, nil
+}
+
+// DeleteBlocksByUserId removes the user's entries and the entries about them.
+func DeleteBlocksByUserId(ctx context.Context, userId primitive.ObjectID) error {
+	if BlocksCollection == nil {
+		BlocksCollection = config.GetCollection(BlocksCollectionName)
+	}
+
+	_, err := BlocksCollection.DeleteMany(ctx, bson.M{"$or": []bson.M{
+		{"userId": userId},
+		{"targetId": userId},
+	}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteBlocksByUserId, err.Error())
+	}
+	return nil
+}
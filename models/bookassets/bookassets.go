@@ -0,0 +1,158 @@
+package bookassets
+
+import (
+	"bytes"
+	"example/aibooks-backend/config/imageconfigs"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/storage"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Book files live in blob storage under books/<bookId>/ with a fresh name per upload,
+// so the PdfPublicId of an uploaded PDF is its storage key and the CoverImagePublicId
+// of an uploaded cover is the key base of its variants. PDFs go to the private store,
+// under private/books/<bookId>/.
+// Books that still point at the old media host keep their ids and are left alone.
+
+const MaxPdfSize = 50 << 20
+const MaxCoverSize = 5 << 20
+
+var AllowedCoverTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+func bookPrefix(bookId primitive.ObjectID) string {
+	return "books/" + bookId.Hex() + "/"
+}
+
+func isOwnedKey(bookId primitive.ObjectID, key string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(key, storage.PrivatePrefix), bookPrefix(bookId))
+}
+
+// IsPdfKey reports whether key is an uploaded book PDF. PDFs are only served to
+// signed in users. PDFs uploaded before the private store existed sit under
+// books/<bookId>/ and stay reachable through STORAGE_PUBLIC_URL until they are
+// uploaded again.
+func IsPdfKey(key string) bool {
+	matched, _ := path.Match("books/*/pdf-*", strings.TrimPrefix(key, storage.PrivatePrefix))
+	return matched
+}
+
+type storedFile struct {
+	suffix      string
+	data        []byte
+	contentType string
+}
+
+// replaceFiles stores files under a new key base in dir, points the book at them through
+// update and removes the files they replace. previousKey may be a single key or the
+// base of a processed cover, both are removed by prefix.
+func replaceFiles(book books.BookData, dir string, name string, files []storedFile, previousKey string, update func(base string) books.BookUpdate) (books.BookData, error) {
+	base := dir + name + "-" + primitive.NewObjectID().Hex()
+	for _, file := range files {
+		if err := storage.Put(base+file.suffix, bytes.NewReader(file.data), int64(len(file.data)), file.contentType); err != nil {
+			storage.DeletePrefix(base)
+			return book, errorHandling.NewAPIError(500, replaceFiles, err.Error())
+		}
+	}
+
+	updated, err := books.UpdateBook(book.Id.Hex(), update(base))
+	if err != nil {
+		storage.DeletePrefix(base)
+		return book, err
+	}
+
+	if isOwnedKey(book.Id, previousKey) {
+		if err := storage.DeletePrefix(previousKey); err != nil {
+			log.Println("Failed to delete replaced book files", previousKey, err)
+		}
+	}
+	return updated, nil
+}
+
+// SavePdf validates the file by size and sniffed content type and attaches it to the book.
+func SavePdf(book books.BookData, data []byte) (books.BookData, error) {
+	if len(data) > MaxPdfSize {
+		return book, errorHandling.NewAPIError(413, SavePdf, "PDF too large")
+	}
+	if http.DetectContentType(data) != "application/pdf" {
+		return book, errorHandling.NewAPIError(415, SavePdf, "Unsupported PDF type")
+	}
+
+	files := []storedFile{{suffix: ".pdf", data: data, contentType: "application/pdf"}}
+	return replaceFiles(book, storage.PrivatePrefix+bookPrefix(book.Id), "pdf", files, book.PdfPublicId, func(base string) books.BookUpdate {
+		key := base + ".pdf"
+		url := storage.Url(key)
+		return books.BookUpdate{PdfPublicId: &key, PdfUrl: &url}
+	})
+}
+
+// SaveCover validates the image, renders it into every cover size as JPEG and WebP
+// and makes it the book's cover. The cover's public id becomes the key base of the
+// variants and its url the large JPEG.
+func SaveCover(book books.BookData, data []byte) (books.BookData, error) {
+	if len(data) > MaxCoverSize {
+		return book, errorHandling.NewAPIError(413, SaveCover, "Cover too large")
+	}
+	if !slices.Contains(AllowedCoverTypes, http.DetectContentType(data)) {
+		return book, errorHandling.NewAPIError(415, SaveCover, "Unsupported cover type")
+	}
+
+	rendered, err := renderCovers(data)
+	if err != nil {
+		return book, err
+	}
+
+	files := []storedFile{}
+	for _, cover := range rendered {
+		files = append(files,
+			storedFile{suffix: "-" + cover.size.name + ".jpg", data: cover.jpeg, contentType: "image/jpeg"},
+			storedFile{suffix: "-" + cover.size.name + ".webp", data: cover.webp, contentType: "image/webp"},
+		)
+	}
+
+	return replaceFiles(book, bookPrefix(book.Id), "cover", files, book.CoverImagePublicId, func(base string) books.BookUpdate {
+		var width, height imageconfigs.ImageWidthHeight
+		var variants imageconfigs.CoverVariants
+		for _, cover := range rendered {
+			jpegUrl := storage.Url(base + "-" + cover.size.name + ".jpg")
+			webpUrl := storage.Url(base + "-" + cover.size.name + ".webp")
+			switch cover.size.name {
+			case "small":
+				width.Small, height.Small = int64(cover.width), int64(cover.height)
+				variants.Jpeg.Small, variants.Webp.Small = jpegUrl, webpUrl
+			case "medium":
+				width.Medium, height.Medium = int64(cover.width), int64(cover.height)
+				variants.Jpeg.Medium, variants.Webp.Medium = jpegUrl, webpUrl
+			case "large":
+				width.Large, height.Large = int64(cover.width), int64(cover.height)
+				variants.Jpeg.Large, variants.Webp.Large = jpegUrl, webpUrl
+			}
+		}
+
+		url := variants.Jpeg.Large
+		return books.BookUpdate{
+			CoverImagePublicId: &base,
+			CoverImageUrl:      &url,
+			CoverImageWidth:    &width,
+			CoverImageHeight:   &height,
+			CoverImageVariants: &variants,
+		}
+	})
+}
+
+// DeleteBookFiles removes every stored file of a book, including ones left behind by
+// failed or replaced uploads.
+func DeleteBookFiles(bookId primitive.ObjectID) error {
+	for _, prefix := range []string{bookPrefix(bookId), storage.PrivatePrefix + bookPrefix(bookId)} {
+		if err := storage.DeletePrefix(prefix); err != nil {
+			return errorHandling.NewAPIError(500, DeleteBookFiles, err.Error())
+		}
+	}
+	return nil
+}
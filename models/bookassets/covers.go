@@ -0,0 +1,114 @@
+package bookassets
+
+import (
+	"bytes"
+	"example/aibooks-backend/config/imageconfigs"
+	"example/aibooks-backend/errorHandling"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxCoverDimension keeps a small compressed file from decoding into a huge bitmap.
+const maxCoverDimension = 8000
+
+const coverJpegQuality = 85
+
+// coverWebpQuality is lossy WebP, which comes out smaller than the JPEG at about the
+// same visual quality. The encoder is libwebp through cgo.
+const coverWebpQuality = 80
+
+type coverSize struct {
+	name   string
+	width  int
+	height int
+}
+
+type renderedCover struct {
+	size   coverSize
+	width  int
+	height int
+	jpeg   []byte
+	webp   []byte
+}
+
+func coverSizes() []coverSize {
+	width, height := imageconfigs.GetDefaultWidth(), imageconfigs.GetDefaultHeight()
+	return []coverSize{
+		{name: "small", width: int(width.Small), height: int(height.Small)},
+		{name: "medium", width: int(width.Medium), height: int(height.Medium)},
+		{name: "large", width: int(width.Large), height: int(height.Large)},
+	}
+}
+
+// cropToAspect returns the largest centred rectangle of bounds with the aspect of width:height.
+func cropToAspect(bounds image.Rectangle, width int, height int) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	if w*height > h*width {
+		cropped := h * width / height
+		x := bounds.Min.X + (w-cropped)/2
+		return image.Rect(x, bounds.Min.Y, x+cropped, bounds.Max.Y)
+	}
+	cropped := w * height / width
+	y := bounds.Min.Y + (h-cropped)/2
+	return image.Rect(bounds.Min.X, y, bounds.Max.X, y+cropped)
+}
+
+// renderCovers decodes the image, crops it to the cover aspect and scales it into
+// every cover size as JPEG and WebP. Images smaller than a size are not scaled up, so
+// the rendered dimensions may be below the nominal ones.
+func renderCovers(data []byte) ([]renderedCover, error) {
+	dimensions, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errorHandling.NewAPIError(415, renderCovers, "Unreadable cover image")
+	}
+	if dimensions.Width > maxCoverDimension || dimensions.Height > maxCoverDimension {
+		return nil, errorHandling.NewAPIError(422, renderCovers, "Cover dimensions too large")
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errorHandling.NewAPIError(415, renderCovers, "Unreadable cover image")
+	}
+
+	sizes := coverSizes()
+	largest := sizes[len(sizes)-1]
+	crop := cropToAspect(src.Bounds(), largest.width, largest.height)
+	if crop.Empty() {
+		return nil, errorHandling.NewAPIError(415, renderCovers, "Cover image too small")
+	}
+
+	rendered := make([]renderedCover, len(sizes))
+	for i, size := range sizes {
+		width, height := size.width, size.height
+		if crop.Dx() < width {
+			width, height = crop.Dx(), max(crop.Dx()*size.height/size.width, 1)
+		}
+
+		// Transparent areas end up white rather than black in the JPEG
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+
+		var jpegBuf, webpBuf bytes.Buffer
+		if err := jpeg.Encode(&jpegBuf, dst, &jpeg.Options{Quality: coverJpegQuality}); err != nil {
+			return nil, errorHandling.NewAPIError(500, renderCovers, err.Error())
+		}
+		if err := webp.Encode(&webpBuf, dst, &webp.Options{Quality: coverWebpQuality}); err != nil {
+			return nil, errorHandling.NewAPIError(500, renderCovers, err.Error())
+		}
+
+		rendered[i] = renderedCover{
+			size:   size,
+			width:  width,
+			height: height,
+			jpeg:   jpegBuf.Bytes(),
+			webp:   webpBuf.Bytes(),
+		}
+	}
+	return rendered, nil
+}
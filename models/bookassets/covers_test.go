@@ -0,0 +1,101 @@
+package bookassets
+
+import (
+	"bytes"
+	"example/aibooks-backend/errorHandling"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestCropToAspect(t *testing.T) {
+	tests := []struct {
+		name   string
+		bounds image.Rectangle
+		want   image.Rectangle
+	}{
+		{"wide", image.Rect(0, 0, 600, 300), image.Rect(200, 0, 400, 300)},
+		{"tall", image.Rect(0, 0, 200, 600), image.Rect(0, 150, 200, 450)},
+		{"exact aspect", image.Rect(0, 0, 200, 300), image.Rect(0, 0, 200, 300)},
+		{"wide with offset origin", image.Rect(100, 50, 700, 350), image.Rect(300, 50, 500, 350)},
+		{"tall with negative origin", image.Rect(-100, -200, 100, 400), image.Rect(-100, -50, 100, 250)},
+		{"1px", image.Rect(0, 0, 1, 1), image.Rect(0, 0, 0, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cropToAspect(tt.bounds, 2, 3)
+			if got != tt.want {
+				t.Errorf("cropToAspect(%v, 2, 3) = %v, want %v", tt.bounds, got, tt.want)
+			}
+			if !got.In(tt.bounds) {
+				t.Errorf("cropToAspect(%v, 2, 3) = %v, which is outside the bounds", tt.bounds, got)
+			}
+		})
+	}
+
+	if got := cropToAspect(image.Rect(0, 0, 1, 1), 2, 3); !got.Empty() {
+		t.Errorf("cropToAspect of a 1px image = %v, want an empty crop", got)
+	}
+}
+
+func encodePng(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRenderCovers(t *testing.T) {
+	rendered, err := renderCovers(encodePng(t, 1000, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := coverSizes()
+	if len(rendered) != len(sizes) {
+		t.Fatalf("renderCovers returned %d covers, want %d", len(rendered), len(sizes))
+	}
+	for i, cover := range rendered {
+		jpegImg, err := jpeg.Decode(bytes.NewReader(cover.jpeg))
+		if err != nil {
+			t.Fatalf("%s JPEG: %v", cover.size.name, err)
+		}
+		webpImg, err := webp.Decode(bytes.NewReader(cover.webp))
+		if err != nil {
+			t.Fatalf("%s WebP: %v", cover.size.name, err)
+		}
+
+		want := image.Rect(0, 0, cover.width, cover.height)
+		if jpegImg.Bounds() != want || webpImg.Bounds() != want {
+			t.Errorf("%s bounds = %v and %v, want %v", cover.size.name, jpegImg.Bounds(), webpImg.Bounds(), want)
+		}
+		if cover.width > sizes[i].width || cover.height > sizes[i].height {
+			t.Errorf("%s = %dx%d, larger than %dx%d", cover.size.name, cover.width, cover.height, sizes[i].width, sizes[i].height)
+		}
+
+		// A lossy WebP has a "VP8 " chunk, a lossless one "VP8L"
+		if len(cover.webp) < 16 || string(cover.webp[12:16]) != "VP8 " {
+			t.Errorf("%s WebP is not lossy", cover.size.name)
+		}
+	}
+}
+
+func TestRenderCoversTooSmall(t *testing.T) {
+	_, err := renderCovers(encodePng(t, 1, 1))
+	if apiErr, ok := err.(errorHandling.APIError); !ok || apiErr.Status != 415 {
+		t.Errorf("renderCovers of a 1px image = %v, want a 415", err)
+	}
+}
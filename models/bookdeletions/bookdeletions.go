@@ -0,0 +1,54 @@
+package bookdeletions
+
+import (
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/activities"
+	"example/aibooks-backend/models/bookassets"
+	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/models/userlibrarys"
+	"log"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DeleteBook removes the book with its ratings, the activity about it and every
+// library entry pointing at it in one transaction, then its stored files.
+func DeleteBook(book books.BookData) error {
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	client := config.GetDB().Client()
+	session, err := client.StartSession()
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteBook, "Failed to start session")
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := books.DeleteRatingsByBookId(sessCtx, book.Id); err != nil {
+			return nil, err
+		}
+		if err := userlibrarys.RemoveBookFromAllLibraries(sessCtx, book.Id); err != nil {
+			return nil, err
+		}
+		if err := activities.DeleteActivitiesByBookId(sessCtx, book.Id); err != nil {
+			return nil, err
+		}
+		if err := books.DeleteBookById(sessCtx, book.Id); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+	if apiErr, ok := err.(errorHandling.APIError); ok && apiErr.Status == 404 {
+		return apiErr
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, DeleteBook, err.Error())
+	}
+
+	// Blob storage is not part of the transaction, the book is gone either way
+	if err := bookassets.DeleteBookFiles(book.Id); err != nil {
+		log.Println("Failed to delete files of book", book.Id.Hex(), err)
+	}
+	return nil
+}
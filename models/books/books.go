@@ -1,8 +1,13 @@
 package books
 
 import (
+	"context"
 	"example/aibooks-backend/config"
+	"example/aibooks-backend/config/imageconfigs"
 	"example/aibooks-backend/errorHandling"
+	"regexp"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,26 +16,34 @@ import (
 )
 
 type BookData struct {
-	Id                 primitive.ObjectID `bson:"_id" json:"id"`
-	Title              string             `bson:"title" json:"title"`
-	Summary            string             `bson:"summary" json:"summary"`
-	TotalChapters      int                `bson:"totalChapters" json:"totalChapters"`
-	Genre              []string           `bson:"genre" json:"genre"`
-	PdfUrl             string             `bson:"pdfUrl" json:"pdfUrl"`
-	PdfPublicId        string             `bson:"pdfPublicId" json:"pdfPublicId"`
-	CoverImageUrl      string             `bson:"coverImageUrl" json:"coverImageUrl"`
-	CoverImagePublicId string             `bson:"coverImagePublicId" json:"coverImagePublicId"`
-	CreatedAt          primitive.DateTime `bson:"createdAt" json:"createdAt"`
-	TotalRatings       int                `bson:"totalRatings" json:"totalRatings"`
-	SumRatings         float64            `bson:"sumRatings" json:"sumRatings"`
+	Id                 primitive.ObjectID             `bson:"_id" json:"id"`
+	Title              string                         `bson:"title" json:"title"`
+	Slug               string                         `bson:"slug,omitempty" json:"slug"`
+	Summary            string                         `bson:"summary" json:"summary"`
+	TotalChapters      int                            `bson:"totalChapters" json:"totalChapters"`
+	Genre              []string                       `bson:"genre" json:"genre"`
+	PdfUrl             string                         `bson:"pdfUrl" json:"pdfUrl"`
+	PdfPublicId        string                         `bson:"pdfPublicId" json:"pdfPublicId"`
+	CoverImageUrl      string                         `bson:"coverImageUrl" json:"coverImageUrl"`
+	CoverImagePublicId string                         `bson:"coverImagePublicId" json:"coverImagePublicId"`
+	CoverImageWidth    *imageconfigs.ImageWidthHeight `bson:"coverImageWidth,omitempty" json:"coverImageWidth,omitempty"`
+	CoverImageHeight   *imageconfigs.ImageWidthHeight `bson:"coverImageHeight,omitempty" json:"coverImageHeight,omitempty"`
+	CoverImageVariants *imageconfigs.CoverVariants    `bson:"coverImageVariants,omitempty" json:"coverImageVariants,omitempty"`
+	CreatedAt          primitive.DateTime             `bson:"createdAt" json:"createdAt"`
+	UpdatedAt          primitive.DateTime             `bson:"updatedAt,omitempty" json:"updatedAt"`
+	TotalRatings       int                            `bson:"totalRatings" json:"totalRatings"`
+	SumRatings         float64                        `bson:"sumRatings" json:"sumRatings"`
 }
 
 type BookDataShort struct {
-	Id                 primitive.ObjectID `bson:"_id" json:"id"`
-	Title              string             `bson:"title" json:"title"`
-	Genre              []string           `bson:"genre" json:"genre"`
-	CoverImageUrl      string             `bson:"coverImageUrl" json:"coverImageUrl"`
-	CoverImagePublicId string             `bson:"coverImagePublicId" json:"coverImagePublicId"`
+	Id                 primitive.ObjectID             `bson:"_id" json:"id"`
+	Title              string                         `bson:"title" json:"title"`
+	Genre              []string                       `bson:"genre" json:"genre"`
+	CoverImageUrl      string                         `bson:"coverImageUrl" json:"coverImageUrl"`
+	CoverImagePublicId string                         `bson:"coverImagePublicId" json:"coverImagePublicId"`
+	CoverImageWidth    *imageconfigs.ImageWidthHeight `bson:"coverImageWidth,omitempty" json:"coverImageWidth,omitempty"`
+	CoverImageHeight   *imageconfigs.ImageWidthHeight `bson:"coverImageHeight,omitempty" json:"coverImageHeight,omitempty"`
+	CoverImageVariants *imageconfigs.CoverVariants    `bson:"coverImageVariants,omitempty" json:"coverImageVariants,omitempty"`
 }
 
 type RelatedBooks struct {
@@ -40,6 +53,26 @@ type RelatedBooks struct {
 var BooksCollectionName string = "bookdatas"
 var BooksCollection *mongo.Collection
 
+func CreateBookIndexes() error {
+	if BooksCollection == nil {
+		BooksCollection = config.GetCollection(BooksCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	// Books created by hand before slugs existed have none, so only real slugs must be unique
+	_, err := BooksCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "slug", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"slug": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateBookIndexes, err.Error())
+	}
+	return nil
+}
+
 func GetBookById(id string) (BookData, error) {
 	if BooksCollection == nil {
 		BooksCollection = config.GetCollection(BooksCollectionName)
@@ -158,11 +191,15 @@ func SearchSuggestions(query string, limit int64) ([]BookDataShort, error) {
 	cursor, err := BooksCollection.Find(ctx, filter, &options.FindOptions{
 		Limit: &limit,
 		Projection: bson.M{
-			"id":            1,
-			"title":         1,
-			"genre":         1,
-			"coverImageUrl": 1,
-			"publicId":      1,
+			"id":                 1,
+			"title":              1,
+			"genre":              1,
+			"coverImageUrl":      1,
+			"publicId":           1,
+			"coverImagePublicId": 1,
+			"coverImageWidth":    1,
+			"coverImageHeight":   1,
+			"coverImageVariants": 1,
 		},
 	})
 	if err != nil {
@@ -273,3 +310,163 @@ func GetRelatedBooks(bookId string, limit int64) (RelatedBooks, error) {
 	}
 	return result[0], nil
 }
+
+// BookUpdate holds the editable catalog fields of a book. Nil fields are left unchanged.
+type BookUpdate struct {
+	Title              *string
+	Slug               *string
+	Summary            *string
+	Genre              *[]string
+	TotalChapters      *int
+	PdfUrl             *string
+	PdfPublicId        *string
+	CoverImageUrl      *string
+	CoverImagePublicId *string
+	// Only set together with the url of a processed cover
+	CoverImageWidth    *imageconfigs.ImageWidthHeight
+	CoverImageHeight   *imageconfigs.ImageWidthHeight
+	CoverImageVariants *imageconfigs.CoverVariants
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify turns a title into a slug, e.g. "The Hobbit: 2nd Ed." becomes "the-hobbit-2nd-ed".
+func Slugify(title string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(title), "-"), "-")
+}
+
+// DefaultSlug is the slug of a book that wasn't given one. Titles without any ASCII
+// letters or digits have no slug of their own, those books use their id.
+func DefaultSlug(title string, id primitive.ObjectID) string {
+	if slug := Slugify(title); slug != "" {
+		return slug
+	}
+	return id.Hex()
+}
+
+func CreateBook(book BookData) (BookData, error) {
+	if BooksCollection == nil {
+		BooksCollection = config.GetCollection(BooksCollectionName)
+	}
+
+	book.Id = primitive.NewObjectID()
+	if book.Slug == "" {
+		book.Slug = DefaultSlug(book.Title, book.Id)
+	}
+	if !slugPattern.MatchString(book.Slug) {
+		return book, errorHandling.NewAPIError(400, CreateBook, "Invalid slug")
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	book.CreatedAt = now
+	book.UpdatedAt = now
+	book.TotalRatings = 0
+	book.SumRatings = 0
+
+	_, err := BooksCollection.InsertOne(ctx, book)
+	if mongo.IsDuplicateKeyError(err) {
+		return book, errorHandling.NewAPIError(409, CreateBook, "Slug already in use")
+	} else if err != nil {
+		return book, errorHandling.NewAPIError(500, CreateBook, err.Error())
+	}
+	return book, nil
+}
+
+// UpdateBook applies update to the book and returns the result.
+func UpdateBook(id string, update BookUpdate) (BookData, error) {
+	if BooksCollection == nil {
+		BooksCollection = config.GetCollection(BooksCollectionName)
+	}
+
+	var book BookData
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err == primitive.ErrInvalidHex {
+		return book, errorHandling.NewAPIError(400, UpdateBook, "Invalid book id")
+	} else if err != nil {
+		return book, errorHandling.NewAPIError(500, UpdateBook, err.Error())
+	}
+
+	if update.Slug != nil && !slugPattern.MatchString(*update.Slug) {
+		return book, errorHandling.NewAPIError(400, UpdateBook, "Invalid slug")
+	}
+
+	set := bson.M{"updatedAt": primitive.NewDateTimeFromTime(time.Now())}
+	if update.Title != nil {
+		set["title"] = *update.Title
+	}
+	if update.Slug != nil {
+		set["slug"] = *update.Slug
+	}
+	if update.Summary != nil {
+		set["summary"] = *update.Summary
+	}
+	if update.Genre != nil {
+		set["genre"] = *update.Genre
+	}
+	if update.TotalChapters != nil {
+		set["totalChapters"] = *update.TotalChapters
+	}
+	if update.PdfUrl != nil {
+		set["pdfUrl"] = *update.PdfUrl
+	}
+	if update.PdfPublicId != nil {
+		set["pdfPublicId"] = *update.PdfPublicId
+	}
+	if update.CoverImageUrl != nil {
+		set["coverImageUrl"] = *update.CoverImageUrl
+	}
+	if update.CoverImagePublicId != nil {
+		set["coverImagePublicId"] = *update.CoverImagePublicId
+	}
+	if update.CoverImageVariants != nil {
+		set["coverImageWidth"] = update.CoverImageWidth
+		set["coverImageHeight"] = update.CoverImageHeight
+		set["coverImageVariants"] = update.CoverImageVariants
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	// A cover set by url alone has no known variants, so drop those of the one it replaces
+	if update.CoverImageUrl != nil && update.CoverImageVariants == nil {
+		_, err := BooksCollection.UpdateOne(ctx,
+			bson.M{"_id": idObj, "coverImageUrl": bson.M{"$ne": *update.CoverImageUrl}},
+			bson.M{"$unset": bson.M{"coverImageWidth": "", "coverImageHeight": "", "coverImageVariants": ""}},
+		)
+		if err != nil {
+			return book, errorHandling.NewAPIError(500, UpdateBook, err.Error())
+		}
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = BooksCollection.FindOneAndUpdate(ctx, bson.M{"_id": idObj}, bson.M{"$set": set}, opts).Decode(&book)
+	if err == mongo.ErrNoDocuments {
+		return book, errorHandling.NewAPIError(404, UpdateBook, "Book not found")
+	} else if mongo.IsDuplicateKeyError(err) {
+		return book, errorHandling.NewAPIError(409, UpdateBook, "Slug already in use")
+	} else if err != nil {
+		return book, errorHandling.NewAPIError(500, UpdateBook, err.Error())
+	}
+	return book, nil
+}
+
+// DeleteBookById removes the book document only. Use bookdeletions.DeleteBook to also
+// remove its ratings and library entries.
+func DeleteBookById(ctx context.Context, id primitive.ObjectID) error {
+	if BooksCollection == nil {
+		BooksCollection = config.GetCollection(BooksCollectionName)
+	}
+
+	result, err := BooksCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteBookById, err.Error())
+	}
+	if result.DeletedCount == 0 {
+		return errorHandling.NewAPIError(404, DeleteBookById, "Book not found")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package books
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"The Hobbit: 2nd Ed.", "the-hobbit-2nd-ed"},
+		{"  Dune  ", "dune"},
+		{"1984", "1984"},
+		{"Harry Potter -- and the   Goblet of Fire", "harry-potter-and-the-goblet-of-fire"},
+		{"Don't Panic!", "don-t-panic"},
+		{"Café Society", "caf-society"},
+		{"Ünïcödé", "n-c-d"},
+		{"戦争と平和", ""},
+		{"Война и мир", ""},
+		{"?!... ---", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got := Slugify(tt.title)
+		if got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+		if got != "" && !slugPattern.MatchString(got) {
+			t.Errorf("Slugify(%q) = %q, which is not a valid slug", tt.title, got)
+		}
+	}
+}
+
+func TestDefaultSlug(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	tests := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{"ascii title", "The Hobbit", "the-hobbit"},
+		{"partly unicode title", "Café Society", "caf-society"},
+		{"unicode only title", "戦争と平和", id.Hex()},
+		{"punctuation only title", "?!...", id.Hex()},
+		{"empty title", "", id.Hex()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DefaultSlug(tt.title, id)
+			if got != tt.want {
+				t.Errorf("DefaultSlug(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+			if !slugPattern.MatchString(got) {
+				t.Errorf("DefaultSlug(%q) = %q, which CreateBook would reject", tt.title, got)
+			}
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package books
 
 import (
+	"context"
 	"example/aibooks-backend/config"
 	"example/aibooks-backend/errorHandling"
-	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/models/activities"
+	"example/aibooks-backend/models/blocks"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -29,12 +31,76 @@ type RatingResponse struct {
 	Review    string             `bson:"review" json:"review"`
 	CreatedAt primitive.DateTime `bson:"createdAt" json:"createdAt"`
 	UpdatedAt primitive.DateTime `bson:"updatedAt" json:"updatedAt"`
-	User      users.Users        `bson:"user" json:"user"`
+	User      RatingUser         `bson:"user" json:"user"`
+}
+
+// RatingUser is the reviewer as joined by the ratings $lookup. It only has the
+// fields that may be shown next to a review.
+type RatingUser struct {
+	Id           primitive.ObjectID  `bson:"_id" json:"id"`
+	FirstName    string              `bson:"first_name" json:"first_name"`
+	LastName     string              `bson:"last_name" json:"last_name"`
+	DisplayName  string              `bson:"display_name,omitempty" json:"display_name,omitempty"`
+	AvatarFileId *primitive.ObjectID `bson:"avatar_file_id,omitempty" json:"-"`
+}
+
+// ratingUserProjection keeps the joined user document down to RatingUser's fields.
+var ratingUserProjection = bson.M{
+	"$project": bson.M{
+		"_id":       1,
+		"userId":    1,
+		"bookId":    1,
+		"rating":    1,
+		"review":    1,
+		"createdAt": 1,
+		"updatedAt": 1,
+		"user": bson.M{
+			"_id":            1,
+			"first_name":     1,
+			"last_name":      1,
+			"display_name":   1,
+			"avatar_file_id": 1,
+		},
+	},
 }
 
 var RatingsCollectionName string = "ratings"
 var RatingsCollection *mongo.Collection
 
+func CreateIndexes() error {
+	if RatingsCollection == nil {
+		RatingsCollection = config.GetCollection(RatingsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := RatingsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "bookId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+// visibleReviewersMatch drops ratings whose author hides them from viewerId. It must
+// run after the user $lookup and before ratingUserProjection.
+func visibleReviewersMatch(viewerId primitive.ObjectID) bson.M {
+	return bson.M{
+		"$match": bson.M{
+			"$or": []bson.M{
+				{"user._id": viewerId},
+				{
+					"user.privacy.private_profile": bson.M{"$ne": true},
+					"user.privacy.hide_ratings":    bson.M{"$ne": true},
+				},
+			},
+		},
+	}
+}
+
 func AddRating(rating Rating) (primitive.ObjectID, error) {
 	if RatingsCollection == nil {
 		RatingsCollection = config.GetCollection(RatingsCollectionName)
@@ -88,6 +154,10 @@ func AddRating(rating Rating) (primitive.ObjectID, error) {
 				return nil, err
 			}
 
+			if err := activities.UpdateRatingActivity(sessCtx, existingRating.Id, rating.Rating, rating.Review); err != nil {
+				return nil, err
+			}
+
 			return existingRating.Id, nil
 		}
 
@@ -117,6 +187,18 @@ func AddRating(rating Rating) (primitive.ObjectID, error) {
 			return nil, err
 		}
 
+		err = activities.RecordActivity(sessCtx, activities.Activity{
+			ActorId:  rating.UserId,
+			Type:     activities.TypeRated,
+			BookId:   rating.BookId,
+			RatingId: &rating.Id,
+			Rating:   rating.Rating,
+			Review:   rating.Review,
+		})
+		if err != nil {
+			return nil, err
+		}
+
 		return rating.Id, nil
 	})
 
@@ -194,6 +276,7 @@ func GetMyRatingForBookId(userId string, bookId string) (RatingResponse, error)
 		{
 			"$unwind": "$user",
 		},
+		ratingUserProjection,
 	}
 
 	cursor, err := RatingsCollection.Aggregate(ctx, pipeline)
@@ -215,7 +298,9 @@ func GetMyRatingForBookId(userId string, bookId string) (RatingResponse, error)
 	return results[0], nil
 }
 
-func GetRatingsByBookId(bookId string, limit int, page int, sortBy string, sortOrder int) ([]RatingResponse, error) {
+// GetRatingsByBookId lists a book's ratings with their authors, leaving out those whose
+// author hides their ratings from viewerId.
+func GetRatingsByBookId(viewerId primitive.ObjectID, bookId string, limit int, page int, sortBy string, sortOrder int) ([]RatingResponse, error) {
 	if RatingsCollection == nil {
 		RatingsCollection = config.GetCollection(RatingsCollectionName)
 	}
@@ -231,12 +316,18 @@ func GetRatingsByBookId(bookId string, limit int, page int, sortBy string, sortO
 		return ratings, errorHandling.NewAPIError(500, GetRatingsByBookId, err.Error())
 	}
 
+	hiddenIds, err := blocks.GetHiddenUserIds(viewerId)
+	if err != nil {
+		return ratings, err
+	}
+
 	skip := limit * (page - 1)
 
 	pipeline := []bson.M{
 		{
 			"$match": bson.M{
 				"bookId": idObj,
+				"userId": bson.M{"$nin": hiddenIds},
 			},
 		},
 		{
@@ -250,23 +341,8 @@ func GetRatingsByBookId(bookId string, limit int, page int, sortBy string, sortO
 		{
 			"$unwind": "$user",
 		},
-		{
-			"$project": bson.M{
-				"_id":       1,
-				"userId":    1,
-				"bookId":    1,
-				"rating":    1,
-				"review":    1,
-				"createdAt": 1,
-				"updatedAt": 1,
-				"user": bson.M{
-					"_id":        1,
-					"first_name": 1,
-					"last_name":  1,
-					"email":      1,
-				},
-			},
-		},
+		visibleReviewersMatch(viewerId),
+		ratingUserProjection,
 		{
 			"$sort": bson.M{
 				sortBy: sortOrder,
@@ -383,11 +459,220 @@ func DeleteRatingById(id string, userId string) error {
 		return errorHandling.NewAPIError(500, DeleteRatingById, err.Error())
 	}
 
-	_, err = RatingsCollection.DeleteOne(ctx, bson.M{"_id": idObj, "userId": userIdObj})
+	result, err := RatingsCollection.DeleteOne(ctx, bson.M{"_id": idObj, "userId": userIdObj})
 	if err == mongo.ErrNoDocuments {
 		return errorHandling.NewAPIError(404, err, "Rating not found")
 	} else if err != nil {
 		return errorHandling.NewAPIError(500, DeleteRatingById, err.Error())
 	}
+
+	if result.DeletedCount > 0 {
+		if err := activities.DeleteRatingActivity(ctx, idObj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRatingsByUserId removes every rating of the user and takes them out of the
+// affected books' sumRatings and totalRatings. Meant to run inside a transaction.
+func DeleteRatingsByUserId(ctx context.Context, userId primitive.ObjectID) error {
+	if RatingsCollection == nil {
+		RatingsCollection = config.GetCollection(RatingsCollectionName)
+	}
+
+	if BooksCollection == nil {
+		BooksCollection = config.GetCollection(BooksCollectionName)
+	}
+
+	cursor, err := RatingsCollection.Find(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteRatingsByUserId, err.Error())
+	}
+
+	var ratings []Rating
+	if err := cursor.All(ctx, &ratings); err != nil {
+		return errorHandling.NewAPIError(500, DeleteRatingsByUserId, err.Error())
+	}
+
+	if len(ratings) == 0 {
+		return nil
+	}
+
+	bookUpdates := make([]mongo.WriteModel, len(ratings))
+	for i, rating := range ratings {
+		bookUpdates[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": rating.BookId}).
+			SetUpdate(bson.M{"$inc": bson.M{"sumRatings": -rating.Rating, "totalRatings": -1}})
+	}
+
+	_, err = BooksCollection.BulkWrite(ctx, bookUpdates)
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteRatingsByUserId, err.Error())
+	}
+
+	_, err = RatingsCollection.DeleteMany(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteRatingsByUserId, err.Error())
+	}
+	return nil
+}
+
+// DeleteRatingsByBookId removes every rating of a book that is being deleted, so its
+// counters are not updated. Meant to run inside a transaction.
+func DeleteRatingsByBookId(ctx context.Context, bookId primitive.ObjectID) error {
+	if RatingsCollection == nil {
+		RatingsCollection = config.GetCollection(RatingsCollectionName)
+	}
+
+	_, err := RatingsCollection.DeleteMany(ctx, bson.M{"bookId": bookId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteRatingsByBookId, err.Error())
+	}
 	return nil
 }
+
+type RatingWithBookTitle struct {
+	Id        primitive.ObjectID `bson:"_id" json:"id"`
+	BookId    primitive.ObjectID `bson:"bookId" json:"bookId"`
+	BookTitle string             `bson:"bookTitle" json:"bookTitle"`
+	Rating    int                `bson:"rating" json:"rating"`
+	Review    string             `bson:"review" json:"review"`
+	CreatedAt primitive.DateTime `bson:"createdAt" json:"createdAt"`
+	UpdatedAt primitive.DateTime `bson:"updatedAt" json:"updatedAt"`
+}
+
+// bookTitleStages joins each rating with the title of its book into RatingWithBookTitle.
+func bookTitleStages() []bson.M {
+	return []bson.M{
+		{
+			"$lookup": bson.M{
+				"from":         BooksCollectionName,
+				"localField":   "bookId",
+				"foreignField": "_id",
+				"as":           "book",
+			},
+		},
+		{
+			"$project": bson.M{
+				"bookId":    1,
+				"rating":    1,
+				"review":    1,
+				"createdAt": 1,
+				"updatedAt": 1,
+				"bookTitle": bson.M{"$ifNull": []interface{}{bson.M{"$first": "$book.title"}, ""}},
+			},
+		},
+	}
+}
+
+func GetRatingsWithBookTitleByUserId(userId primitive.ObjectID) ([]RatingWithBookTitle, error) {
+	if RatingsCollection == nil {
+		RatingsCollection = config.GetCollection(RatingsCollectionName)
+	}
+
+	ratings := []RatingWithBookTitle{}
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	pipeline := []bson.M{{"$match": bson.M{"userId": userId}}}
+	pipeline = append(pipeline, bookTitleStages()...)
+	pipeline = append(pipeline, bson.M{"$sort": bson.M{"createdAt": 1}})
+
+	cursor, err := RatingsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return ratings, errorHandling.NewAPIError(500, GetRatingsWithBookTitleByUserId, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &ratings); err != nil {
+		return ratings, errorHandling.NewAPIError(500, GetRatingsWithBookTitleByUserId, err.Error())
+	}
+	return ratings, nil
+}
+
+func CountRatingsByUserId(userId primitive.ObjectID) (int64, error) {
+	if RatingsCollection == nil {
+		RatingsCollection = config.GetCollection(RatingsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	count, err := RatingsCollection.CountDocuments(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return 0, errorHandling.NewAPIError(500, CountRatingsByUserId, err.Error())
+	}
+	return count, nil
+}
+
+func GetRecentRatingsWithBookTitleByUserId(userId primitive.ObjectID, limit int64) ([]RatingWithBookTitle, error) {
+	if RatingsCollection == nil {
+		RatingsCollection = config.GetCollection(RatingsCollectionName)
+	}
+
+	ratings := []RatingWithBookTitle{}
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	// Sort and limit before the book $lookup so only the returned ratings are joined
+	pipeline := []bson.M{
+		{"$match": bson.M{"userId": userId}},
+		{"$sort": bson.M{"createdAt": -1}},
+		{"$limit": limit},
+	}
+	pipeline = append(pipeline, bookTitleStages()...)
+
+	cursor, err := RatingsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return ratings, errorHandling.NewAPIError(500, GetRecentRatingsWithBookTitleByUserId, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &ratings); err != nil {
+		return ratings, errorHandling.NewAPIError(500, GetRecentRatingsWithBookTitleByUserId, err.Error())
+	}
+	return ratings, nil
+}
+
+type RatingStats struct {
+	Count         int64   `bson:"count" json:"count"`
+	AverageRating float64 `bson:"averageRating" json:"averageRating"`
+}
+
+// GetRatingStatsByUserId returns how many ratings a user has given and their average.
+func GetRatingStatsByUserId(userId primitive.ObjectID) (RatingStats, error) {
+	if RatingsCollection == nil {
+		RatingsCollection = config.GetCollection(RatingsCollectionName)
+	}
+
+	var stats RatingStats
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"userId": userId}},
+		{
+			"$group": bson.M{
+				"_id":           nil,
+				"count":         bson.M{"$sum": 1},
+				"averageRating": bson.M{"$avg": "$rating"},
+			},
+		},
+	}
+
+	cursor, err := RatingsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return stats, errorHandling.NewAPIError(500, GetRatingStatsByUserId, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	var results []RatingStats
+	if err := cursor.All(ctx, &results); err != nil {
+		return stats, errorHandling.NewAPIError(500, GetRatingStatsByUserId, err.Error())
+	}
+	if len(results) == 0 {
+		return stats, nil
+	}
+	return results[0], nil
+}
@@ -0,0 +1,244 @@
+package dataexports
+
+import (
+	"bytes"
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"io"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DataExport tracks an asynchronously built personal data archive. The archive
+// itself is kept in the "dataexports" GridFS bucket.
+type DataExport struct {
+	Id          primitive.ObjectID  `bson:"_id" json:"id"`
+	UserId      primitive.ObjectID  `bson:"userId" json:"userId"`
+	Format      string              `bson:"format" json:"format"`
+	Status      string              `bson:"status" json:"status"`
+	FileId      *primitive.ObjectID `bson:"fileId,omitempty" json:"-"`
+	FileName    string              `bson:"fileName,omitempty" json:"fileName,omitempty"`
+	Error       string              `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   primitive.DateTime  `bson:"createdAt" json:"createdAt"`
+	CompletedAt *primitive.DateTime `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	ExpiresAt   primitive.DateTime  `bson:"expiresAt" json:"expiresAt"`
+}
+
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// ExportTTL is how long a finished archive stays downloadable.
+var ExportTTL = 7 * 24 * time.Hour
+
+var DataExportsCollectionName string = "dataexports"
+var DataExportsCollection *mongo.Collection
+
+func getBucket() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(config.GetDB(), options.GridFSBucket().SetName(DataExportsCollectionName))
+}
+
+func CreateIndexes() error {
+	if DataExportsCollection == nil {
+		DataExportsCollection = config.GetCollection(DataExportsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := DataExportsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+func CreateExport(userId primitive.ObjectID, format string) (DataExport, error) {
+	if DataExportsCollection == nil {
+		DataExportsCollection = config.GetCollection(DataExportsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	now := time.Now()
+	export := DataExport{
+		Id:        primitive.NewObjectID(),
+		UserId:    userId,
+		Format:    format,
+		Status:    StatusPending,
+		CreatedAt: primitive.NewDateTimeFromTime(now),
+		ExpiresAt: primitive.NewDateTimeFromTime(now.Add(ExportTTL)),
+	}
+
+	_, err := DataExportsCollection.InsertOne(ctx, export)
+	if err != nil {
+		return export, errorHandling.NewAPIError(500, CreateExport, err.Error())
+	}
+	return export, nil
+}
+
+// CompleteExport stores the archive and marks the export ready.
+func CompleteExport(id primitive.ObjectID, fileName string, data []byte) error {
+	if DataExportsCollection == nil {
+		DataExportsCollection = config.GetCollection(DataExportsCollectionName)
+	}
+
+	bucket, err := getBucket()
+	if err != nil {
+		return errorHandling.NewAPIError(500, CompleteExport, err.Error())
+	}
+
+	fileId, err := bucket.UploadFromStream(fileName, bytes.NewReader(data))
+	if err != nil {
+		return errorHandling.NewAPIError(500, CompleteExport, err.Error())
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err = DataExportsCollection.UpdateByID(ctx, id, bson.M{"$set": bson.M{
+		"status":      StatusReady,
+		"fileId":      fileId,
+		"fileName":    fileName,
+		"completedAt": primitive.NewDateTimeFromTime(time.Now()),
+	}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CompleteExport, err.Error())
+	}
+	return nil
+}
+
+func FailExport(id primitive.ObjectID, reason string) error {
+	if DataExportsCollection == nil {
+		DataExportsCollection = config.GetCollection(DataExportsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := DataExportsCollection.UpdateByID(ctx, id, bson.M{"$set": bson.M{
+		"status":      StatusFailed,
+		"error":       reason,
+		"completedAt": primitive.NewDateTimeFromTime(time.Now()),
+	}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, FailExport, err.Error())
+	}
+	return nil
+}
+
+func GetExportById(id string, userId string) (DataExport, error) {
+	if DataExportsCollection == nil {
+		DataExportsCollection = config.GetCollection(DataExportsCollectionName)
+	}
+
+	var export DataExport
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err == primitive.ErrInvalidHex {
+		return export, errorHandling.NewAPIError(400, GetExportById, "Invalid export id")
+	} else if err != nil {
+		return export, errorHandling.NewAPIError(500, GetExportById, err.Error())
+	}
+
+	userIdObj, err := primitive.ObjectIDFromHex(userId)
+	if err == primitive.ErrInvalidHex {
+		return export, errorHandling.NewAPIError(400, GetExportById, "Invalid user id")
+	} else if err != nil {
+		return export, errorHandling.NewAPIError(500, GetExportById, err.Error())
+	}
+
+	err = DataExportsCollection.FindOne(ctx, bson.M{"_id": idObj, "userId": userIdObj}).Decode(&export)
+	if err == mongo.ErrNoDocuments {
+		return export, errorHandling.NewAPIError(404, GetExportById, "Export not found")
+	} else if err != nil {
+		return export, errorHandling.NewAPIError(500, GetExportById, err.Error())
+	}
+	return export, nil
+}
+
+func DownloadExport(export DataExport, w io.Writer) error {
+	if export.FileId == nil {
+		return errorHandling.NewAPIError(404, DownloadExport, "Export file not found")
+	}
+
+	bucket, err := getBucket()
+	if err != nil {
+		return errorHandling.NewAPIError(500, DownloadExport, err.Error())
+	}
+
+	if _, err := bucket.DownloadToStream(*export.FileId, w); err != nil {
+		return errorHandling.NewAPIError(500, DownloadExport, err.Error())
+	}
+	return nil
+}
+
+func deleteExports(filter bson.M) error {
+	if DataExportsCollection == nil {
+		DataExportsCollection = config.GetCollection(DataExportsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	cursor, err := DataExportsCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	var exports []DataExport
+	if err := cursor.All(ctx, &exports); err != nil {
+		return err
+	}
+
+	bucket, err := getBucket()
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.FileId != nil {
+			if err := bucket.DeleteContext(ctx, *export.FileId); err != nil && err != gridfs.ErrFileNotFound {
+				return err
+			}
+		}
+		if _, err := DataExportsCollection.DeleteOne(ctx, bson.M{"_id": export.Id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func DeleteExportsByUserId(userId primitive.ObjectID) error {
+	if err := deleteExports(bson.M{"userId": userId}); err != nil {
+		return errorHandling.NewAPIError(500, DeleteExportsByUserId, err.Error())
+	}
+	return nil
+}
+
+// StartCleanupWorker removes expired exports and their archives every interval.
+func StartCleanupWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			err := deleteExports(bson.M{"expiresAt": bson.M{"$lte": primitive.NewDateTimeFromTime(time.Now())}})
+			if err != nil {
+				log.Println("Failed to clean up expired data exports:", err)
+			}
+		}
+	}()
+}
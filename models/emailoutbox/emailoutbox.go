@@ -0,0 +1,376 @@
+package emailoutbox
+
+import (
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/email"
+	"example/aibooks-backend/errorHandling"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OutboxMessage struct {
+	Id            primitive.ObjectID  `bson:"_id" json:"id"`
+	To            []string            `bson:"to" json:"to"`
+	Template      string              `bson:"template" json:"template"`
+	Data          map[string]string   `bson:"data,omitempty" json:"-"`
+	Subject       string              `bson:"subject" json:"subject"`
+	Text          string              `bson:"text,omitempty" json:"-"`
+	Html          string              `bson:"html,omitempty" json:"-"`
+	Status        string              `bson:"status" json:"status"`
+	Attempts      int                 `bson:"attempts" json:"attempts"`
+	LastError     string              `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	NextAttemptAt primitive.DateTime  `bson:"nextAttemptAt" json:"nextAttemptAt"`
+	LockedUntil   *primitive.DateTime `bson:"lockedUntil,omitempty" json:"-"`
+	SentAt        *primitive.DateTime `bson:"sentAt,omitempty" json:"sentAt,omitempty"`
+	ExpiresAt     *primitive.DateTime `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	CreatedAt     primitive.DateTime  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt     primitive.DateTime  `bson:"updatedAt" json:"updatedAt"`
+}
+
+const (
+	StatusPending = "pending"
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusDead    = "dead"
+)
+
+// A message is retried with exponential backoff starting at RetryBaseDelay and is
+// dead-lettered after MaxAttempts failed deliveries.
+const (
+	MaxAttempts    = 6
+	RetryBaseDelay = 30 * time.Second
+	RetryMaxDelay  = time.Hour
+)
+
+// A claimed message whose worker died is picked up again after lockTimeout.
+var lockTimeout = 5 * time.Minute
+
+// Sent messages are kept this long for support lookups.
+var SentRetention = 30 * 24 * time.Hour
+
+// Pending and dead-lettered messages are removed this long after they were queued or
+// died, so template data with one time codes doesn't stay around indefinitely.
+var UnsentRetention = 7 * 24 * time.Hour
+
+var EmailOutboxCollectionName string = "emailoutbox"
+var EmailOutboxCollection *mongo.Collection
+
+func CreateIndexes() error {
+	if EmailOutboxCollection == nil {
+		EmailOutboxCollection = config.GetCollection(EmailOutboxCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := EmailOutboxCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "to", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "sentAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(SentRetention.Seconds())),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+// Enqueue stores an already rendered message for the worker to deliver. The template
+// data is kept next to it so the message can be rendered again when it is retried.
+func Enqueue(template string, data map[string]string, msg email.Message) (primitive.ObjectID, error) {
+	if EmailOutboxCollection == nil {
+		EmailOutboxCollection = config.GetCollection(EmailOutboxCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	now := time.Now()
+	expiresAt := primitive.NewDateTimeFromTime(now.Add(UnsentRetention))
+	message := OutboxMessage{
+		Id:            primitive.NewObjectID(),
+		To:            msg.To,
+		Template:      template,
+		Data:          data,
+		Subject:       msg.Subject,
+		Text:          msg.Text,
+		Html:          msg.Html,
+		Status:        StatusPending,
+		NextAttemptAt: primitive.NewDateTimeFromTime(now),
+		ExpiresAt:     &expiresAt,
+		CreatedAt:     primitive.NewDateTimeFromTime(now),
+		UpdatedAt:     primitive.NewDateTimeFromTime(now),
+	}
+
+	_, err := EmailOutboxCollection.InsertOne(ctx, message)
+	if err != nil {
+		return primitive.NilObjectID, errorHandling.NewAPIError(500, Enqueue, err.Error())
+	}
+	return message.Id, nil
+}
+
+// claimNext atomically marks the next due message as sending so that concurrent
+// workers never deliver the same message twice.
+func claimNext() (*OutboxMessage, error) {
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"$or": []bson.M{
+			{"status": StatusPending, "nextAttemptAt": bson.M{"$lte": primitive.NewDateTimeFromTime(now)}},
+			{"status": StatusSending, "lockedUntil": bson.M{"$lte": primitive.NewDateTimeFromTime(now)}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      StatusSending,
+			"lockedUntil": primitive.NewDateTimeFromTime(now.Add(lockTimeout)),
+			"updatedAt":   primitive.NewDateTimeFromTime(now),
+		},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.M{"nextAttemptAt": 1}).
+		SetReturnDocument(options.After)
+
+	var message OutboxMessage
+	err := EmailOutboxCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := RetryBaseDelay
+	for i := 1; i < attempts && delay < RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, RetryMaxDelay)
+}
+
+// deliver sends a claimed message and records the outcome. The body is dropped once
+// the message is sent or dead since it may contain one time codes. A dead message
+// keeps its template data until it expires, so it can still be retried.
+func deliver(message *OutboxMessage) error {
+	sendErr := email.Send(email.Message{
+		To:      message.To,
+		Subject: message.Subject,
+		Text:    message.Text,
+		Html:    message.Html,
+	})
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	now := time.Now()
+	var update bson.M
+	if sendErr == nil {
+		update = bson.M{
+			"$set": bson.M{
+				"status":    StatusSent,
+				"sentAt":    primitive.NewDateTimeFromTime(now),
+				"updatedAt": primitive.NewDateTimeFromTime(now),
+			},
+			"$inc":   bson.M{"attempts": 1},
+			"$unset": bson.M{"text": "", "html": "", "data": "", "lockedUntil": "", "expiresAt": ""},
+		}
+	} else if attempts := message.Attempts + 1; attempts < MaxAttempts {
+		update = bson.M{
+			"$set": bson.M{
+				"status":        StatusPending,
+				"lastError":     sendErr.Error(),
+				"nextAttemptAt": primitive.NewDateTimeFromTime(now.Add(retryDelay(attempts))),
+				"updatedAt":     primitive.NewDateTimeFromTime(now),
+			},
+			"$inc":   bson.M{"attempts": 1},
+			"$unset": bson.M{"lockedUntil": ""},
+		}
+	} else {
+		update = bson.M{
+			"$set": bson.M{
+				"status":    StatusDead,
+				"lastError": sendErr.Error(),
+				"expiresAt": primitive.NewDateTimeFromTime(now.Add(UnsentRetention)),
+				"updatedAt": primitive.NewDateTimeFromTime(now),
+			},
+			"$inc":   bson.M{"attempts": 1},
+			"$unset": bson.M{"text": "", "html": "", "lockedUntil": ""},
+		}
+	}
+
+	_, err := EmailOutboxCollection.UpdateOne(ctx, bson.M{"_id": message.Id, "status": StatusSending}, update)
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// ProcessDue delivers due messages until none are left or limit is reached.
+func ProcessDue(limit int) (int, error) {
+	if EmailOutboxCollection == nil {
+		EmailOutboxCollection = config.GetCollection(EmailOutboxCollectionName)
+	}
+
+	processed := 0
+	for processed < limit {
+		message, err := claimNext()
+		if err != nil {
+			return processed, errorHandling.NewAPIError(500, ProcessDue, err.Error())
+		}
+		if message == nil {
+			break
+		}
+
+		if err := deliver(message); err != nil {
+			log.Printf("Failed to deliver email %s (attempt %d): %v\n", message.Id.Hex(), message.Attempts+1, err)
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// StartWorker polls the outbox for due messages every interval.
+func StartWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if _, err := ProcessDue(100); err != nil {
+				log.Println("Failed to process email outbox:", err)
+			}
+		}
+	}()
+}
+
+func GetOutboxMessages(status string, recipient string, page int64, limit int64) ([]OutboxMessage, error) {
+	if EmailOutboxCollection == nil {
+		EmailOutboxCollection = config.GetCollection(EmailOutboxCollectionName)
+	}
+
+	messages := []OutboxMessage{}
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if recipient != "" {
+		filter["to"] = recipient
+	}
+
+	opts := options.Find().
+		SetSort(bson.M{"createdAt": -1}).
+		SetSkip(limit * (page - 1)).
+		SetLimit(limit)
+
+	cursor, err := EmailOutboxCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return messages, errorHandling.NewAPIError(500, GetOutboxMessages, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &messages); err != nil {
+		return messages, errorHandling.NewAPIError(500, GetOutboxMessages, err.Error())
+	}
+	return messages, nil
+}
+
+func GetOutboxMessageById(id string) (OutboxMessage, error) {
+	if EmailOutboxCollection == nil {
+		EmailOutboxCollection = config.GetCollection(EmailOutboxCollectionName)
+	}
+
+	var message OutboxMessage
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err == primitive.ErrInvalidHex {
+		return message, errorHandling.NewAPIError(400, GetOutboxMessageById, "Invalid message id")
+	} else if err != nil {
+		return message, errorHandling.NewAPIError(500, GetOutboxMessageById, err.Error())
+	}
+
+	err = EmailOutboxCollection.FindOne(ctx, bson.M{"_id": idObj}).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return message, errorHandling.NewAPIError(404, GetOutboxMessageById, "Message not found")
+	} else if err != nil {
+		return message, errorHandling.NewAPIError(500, GetOutboxMessageById, err.Error())
+	}
+	return message, nil
+}
+
+// RetryMessage renders a dead-lettered message again from its template and data and
+// puts it back in the queue with a fresh attempt count.
+func RetryMessage(id string) error {
+	if EmailOutboxCollection == nil {
+		EmailOutboxCollection = config.GetCollection(EmailOutboxCollectionName)
+	}
+
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err == primitive.ErrInvalidHex {
+		return errorHandling.NewAPIError(400, RetryMessage, "Invalid message id")
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, RetryMessage, err.Error())
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	var message OutboxMessage
+	err = EmailOutboxCollection.FindOne(ctx, bson.M{"_id": idObj, "status": StatusDead}).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return errorHandling.NewAPIError(404, RetryMessage, "Dead-lettered message not found")
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, RetryMessage, err.Error())
+	}
+
+	// Messages queued before the data was stored can't be rendered again
+	if message.Data == nil {
+		return errorHandling.NewAPIError(409, RetryMessage, "Message has no template data to render")
+	}
+
+	rendered, err := email.Render(message.Template, message.Data)
+	if err != nil {
+		return errorHandling.NewAPIError(500, RetryMessage, err.Error())
+	}
+
+	now := time.Now()
+	result, err := EmailOutboxCollection.UpdateOne(ctx, bson.M{"_id": idObj, "status": StatusDead}, bson.M{
+		"$set": bson.M{
+			"status":        StatusPending,
+			"attempts":      0,
+			"subject":       rendered.Subject,
+			"text":          rendered.Text,
+			"html":          rendered.Html,
+			"nextAttemptAt": primitive.NewDateTimeFromTime(now),
+			"expiresAt":     primitive.NewDateTimeFromTime(now.Add(UnsentRetention)),
+			"updatedAt":     primitive.NewDateTimeFromTime(now),
+		},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, RetryMessage, err.Error())
+	}
+	if result.MatchedCount == 0 {
+		return errorHandling.NewAPIError(404, RetryMessage, "Dead-lettered message not found")
+	}
+	return nil
+}
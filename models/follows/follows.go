@@ -0,0 +1,250 @@
+package follows
+
+import (
+	"context"
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/blocks"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Follow struct {
+	Id         primitive.ObjectID `bson:"_id" json:"id"`
+	FollowerId primitive.ObjectID `bson:"followerId" json:"followerId"`
+	FolloweeId primitive.ObjectID `bson:"followeeId" json:"followeeId"`
+	CreatedAt  primitive.DateTime `bson:"createdAt" json:"createdAt"`
+}
+
+// MaxFollowing caps how many users one account can follow, which bounds the size of
+// the $in a feed query runs.
+const MaxFollowing = 2000
+
+var FollowsCollectionName string = "follows"
+var FollowsCollection *mongo.Collection
+
+func CreateIndexes() error {
+	if FollowsCollection == nil {
+		FollowsCollection = config.GetCollection(FollowsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := FollowsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "followerId", Value: 1}, {Key: "followeeId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "followerId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "followeeId", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+// FollowUser makes followerId follow followeeId. Following someone twice is a no-op,
+// and nobody can follow across a block in either direction.
+func FollowUser(followerId primitive.ObjectID, followeeId primitive.ObjectID) error {
+	if FollowsCollection == nil {
+		FollowsCollection = config.GetCollection(FollowsCollectionName)
+	}
+
+	if followerId == followeeId {
+		return errorHandling.NewAPIError(400, FollowUser, "Cannot follow yourself")
+	}
+
+	for _, pair := range [][2]primitive.ObjectID{{followeeId, followerId}, {followerId, followeeId}} {
+		blocked, err := blocks.IsBlocked(pair[0], pair[1])
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return errorHandling.NewAPIError(403, FollowUser, "Cannot follow this user")
+		}
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	count, err := FollowsCollection.CountDocuments(ctx, bson.M{"followerId": followerId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, FollowUser, err.Error())
+	}
+	if count >= MaxFollowing {
+		return errorHandling.NewAPIError(409, FollowUser, "Following limit reached")
+	}
+
+	_, err = FollowsCollection.UpdateOne(ctx,
+		bson.M{"followerId": followerId, "followeeId": followeeId},
+		bson.M{"$setOnInsert": bson.M{
+			"_id":       primitive.NewObjectID(),
+			"createdAt": primitive.NewDateTimeFromTime(time.Now()),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return errorHandling.NewAPIError(500, FollowUser, err.Error())
+	}
+	return nil
+}
+
+func UnfollowUser(followerId primitive.ObjectID, followeeId primitive.ObjectID) error {
+	if FollowsCollection == nil {
+		FollowsCollection = config.GetCollection(FollowsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := FollowsCollection.DeleteOne(ctx, bson.M{"followerId": followerId, "followeeId": followeeId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, UnfollowUser, err.Error())
+	}
+	return nil
+}
+
+// RemoveFollowsBetween drops the follows between two users in both directions.
+func RemoveFollowsBetween(userId primitive.ObjectID, otherId primitive.ObjectID) error {
+	if FollowsCollection == nil {
+		FollowsCollection = config.GetCollection(FollowsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := FollowsCollection.DeleteMany(ctx, bson.M{"$or": []bson.M{
+		{"followerId": userId, "followeeId": otherId},
+		{"followerId": otherId, "followeeId": userId},
+	}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, RemoveFollowsBetween, err.Error())
+	}
+	return nil
+}
+
+func IsFollowing(followerId primitive.ObjectID, followeeId primitive.ObjectID) (bool, error) {
+	if FollowsCollection == nil {
+		FollowsCollection = config.GetCollection(FollowsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	count, err := FollowsCollection.CountDocuments(ctx, bson.M{"followerId": followerId, "followeeId": followeeId}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, errorHandling.NewAPIError(500, IsFollowing, err.Error())
+	}
+	return count > 0, nil
+}
+
+// GetFolloweeIds returns the ids of every user followerId follows.
+func GetFolloweeIds(followerId primitive.ObjectID) ([]primitive.ObjectID, error) {
+	if FollowsCollection == nil {
+		FollowsCollection = config.GetCollection(FollowsCollectionName)
+	}
+
+	ids := []primitive.ObjectID{}
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"followeeId": 1})
+	cursor, err := FollowsCollection.Find(ctx, bson.M{"followerId": followerId}, opts)
+	if err != nil {
+		return ids, errorHandling.NewAPIError(500, GetFolloweeIds, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	var results []Follow
+	if err := cursor.All(ctx, &results); err != nil {
+		return ids, errorHandling.NewAPIError(500, GetFolloweeIds, err.Error())
+	}
+	for _, follow := range results {
+		ids = append(ids, follow.FolloweeId)
+	}
+	return ids, nil
+}
+
+func getFollows(filter bson.M, before primitive.ObjectID, limit int64) ([]Follow, error) {
+	if FollowsCollection == nil {
+		FollowsCollection = config.GetCollection(FollowsCollectionName)
+	}
+
+	results := []Follow{}
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	if !before.IsZero() {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+
+	opts := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(limit)
+	cursor, err := FollowsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return results, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &results)
+	return results, err
+}
+
+// GetFollowers lists who follows userId, most recent first, paged by the follow id.
+func GetFollowers(userId primitive.ObjectID, before primitive.ObjectID, limit int64) ([]Follow, error) {
+	results, err := getFollows(bson.M{"followeeId": userId}, before, limit)
+	if err != nil {
+		return results, errorHandling.NewAPIError(500, GetFollowers, err.Error())
+	}
+	return results, nil
+}
+
+// GetFollowing lists who userId follows, most recent first, paged by the follow id.
+func GetFollowing(userId primitive.ObjectID, before primitive.ObjectID, limit int64) ([]Follow, error) {
+	results, err := getFollows(bson.M{"followerId": userId}, before, limit)
+	if err != nil {
+		return results, errorHandling.NewAPIError(500, GetFollowing, err.Error())
+	}
+	return results, nil
+}
+
+// CountFollows returns the number of followers and followed users of userId.
+func CountFollows(userId primitive.ObjectID) (int64, int64, error) {
+	if FollowsCollection == nil {
+		FollowsCollection = config.GetCollection(FollowsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	followers, err := FollowsCollection.CountDocuments(ctx, bson.M{"followeeId": userId})
+	if err != nil {
+		return 0, 0, errorHandling.NewAPIError(500, CountFollows, err.Error())
+	}
+	following, err := FollowsCollection.CountDocuments(ctx, bson.M{"followerId": userId})
+	if err != nil {
+		return 0, 0, errorHandling.NewAPIError(500, CountFollows, err.Error())
+	}
+	return followers, following, nil
+}
+
+// DeleteFollowsByUserId removes the user's follows in both directions.
+func DeleteFollowsByUserId(ctx context.Context, userId primitive.ObjectID) error {
+	if FollowsCollection == nil {
+		FollowsCollection = config.GetCollection(FollowsCollectionName)
+	}
+
+	_, err := FollowsCollection.DeleteMany(ctx, bson.M{"$or": []bson.M{
+		{"followerId": userId},
+		{"followeeId": userId},
+	}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteFollowsByUserId, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package loginattempts
+
+import (
+	"context"
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttempt tracks consecutive failed logins for one account or one IP.
+type LoginAttempt struct {
+	Id            primitive.ObjectID `bson:"_id" json:"id"`
+	Kind          string             `bson:"kind" json:"kind"`
+	Key           string             `bson:"key" json:"key"`
+	Failures      int                `bson:"failures" json:"failures"`
+	LockedUntil   primitive.DateTime `bson:"lockedUntil" json:"lockedUntil"`
+	LastFailureAt primitive.DateTime `bson:"lastFailureAt" json:"lastFailureAt"`
+	ExpiresAt     primitive.DateTime `bson:"expiresAt" json:"expiresAt"`
+}
+
+const (
+	KindAccount = "account"
+	KindIp      = "ip"
+)
+
+type policy struct {
+	freeFailures int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+}
+
+// Failures beyond freeFailures lock the key for baseDelay, doubling on every further failure.
+var policies = map[string]policy{
+	KindAccount: {freeFailures: 5, baseDelay: 30 * time.Second, maxDelay: time.Hour},
+	KindIp:      {freeFailures: 20, baseDelay: 30 * time.Second, maxDelay: time.Hour},
+}
+
+// Counters are forgotten after this long without a failure.
+var failureWindow = 24 * time.Hour
+
+var LoginAttemptsCollectionName string = "loginattempts"
+var LoginAttemptsCollection *mongo.Collection
+
+func CreateIndexes() error {
+	if LoginAttemptsCollection == nil {
+		LoginAttemptsCollection = config.GetCollection(LoginAttemptsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := LoginAttemptsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "lockedUntil", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+func normalizeKey(kind string, key string) string {
+	if kind == KindAccount {
+		return strings.ToLower(strings.TrimSpace(key))
+	}
+	return key
+}
+
+// GetLockedUntil returns the latest lock time across the given account and IP, or the zero time if neither is locked.
+func GetLockedUntil(email string, ip string) (time.Time, error) {
+	if LoginAttemptsCollection == nil {
+		LoginAttemptsCollection = config.GetCollection(LoginAttemptsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	filter := bson.M{
+		"$or": []bson.M{
+			{"kind": KindAccount, "key": normalizeKey(KindAccount, email)},
+			{"kind": KindIp, "key": normalizeKey(KindIp, ip)},
+		},
+		"lockedUntil": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())},
+	}
+
+	var attempt LoginAttempt
+	err := LoginAttemptsCollection.FindOne(ctx, filter, options.FindOne().SetSort(bson.M{"lockedUntil": -1})).Decode(&attempt)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, errorHandling.NewAPIError(500, GetLockedUntil, err.Error())
+	}
+
+	return attempt.LockedUntil.Time(), nil
+}
+
+func recordFailure(ctx context.Context, kind string, key string) error {
+	now := time.Now()
+
+	var attempt LoginAttempt
+	err := LoginAttemptsCollection.FindOneAndUpdate(ctx,
+		bson.M{"kind": kind, "key": normalizeKey(kind, key)},
+		bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{
+				"lastFailureAt": primitive.NewDateTimeFromTime(now),
+				"expiresAt":     primitive.NewDateTimeFromTime(now.Add(failureWindow)),
+			},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "lockedUntil": primitive.NewDateTimeFromTime(time.Time{})},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+	if err != nil {
+		return err
+	}
+
+	p := policies[kind]
+	over := attempt.Failures - p.freeFailures
+	if over <= 0 {
+		return nil
+	}
+
+	delay := time.Duration(float64(p.baseDelay) * math.Pow(2, float64(over-1)))
+	if delay > p.maxDelay || delay <= 0 {
+		delay = p.maxDelay
+	}
+
+	_, err = LoginAttemptsCollection.UpdateByID(ctx, attempt.Id, bson.M{
+		"$set": bson.M{"lockedUntil": primitive.NewDateTimeFromTime(now.Add(delay))},
+	})
+	return err
+}
+
+func RecordFailure(email string, ip string) error {
+	if LoginAttemptsCollection == nil {
+		LoginAttemptsCollection = config.GetCollection(LoginAttemptsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	if err := recordFailure(ctx, KindAccount, email); err != nil {
+		return errorHandling.NewAPIError(500, RecordFailure, err.Error())
+	}
+	if err := recordFailure(ctx, KindIp, ip); err != nil {
+		return errorHandling.NewAPIError(500, RecordFailure, err.Error())
+	}
+	return nil
+}
+
+// RecordSuccess clears the account counter. The IP counter is left alone so one
+// valid login can't be used to reset guessing against other accounts.
+func RecordSuccess(email string) error {
+	if LoginAttemptsCollection == nil {
+		LoginAttemptsCollection = config.GetCollection(LoginAttemptsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := LoginAttemptsCollection.DeleteOne(ctx, bson.M{"kind": KindAccount, "key": normalizeKey(KindAccount, email)})
+	if err != nil {
+		return errorHandling.NewAPIError(500, RecordSuccess, err.Error())
+	}
+	return nil
+}
+
+func GetActiveLockouts(page int64, limit int64) ([]LoginAttempt, error) {
+	if LoginAttemptsCollection == nil {
+		LoginAttemptsCollection = config.GetCollection(LoginAttemptsCollectionName)
+	}
+
+	lockouts := []LoginAttempt{}
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.M{"lockedUntil": -1}).
+		SetSkip(limit * (page - 1)).
+		SetLimit(limit)
+
+	cursor, err := LoginAttemptsCollection.Find(ctx, bson.M{"lockedUntil": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())}}, opts)
+	if err != nil {
+		return lockouts, errorHandling.NewAPIError(500, GetActiveLockouts, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &lockouts); err != nil {
+		return lockouts, errorHandling.NewAPIError(500, GetActiveLockouts, err.Error())
+	}
+	return lockouts, nil
+}
+
+func ClearLockout(id string) error {
+	if LoginAttemptsCollection == nil {
+		LoginAttemptsCollection = config.GetCollection(LoginAttemptsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err == primitive.ErrInvalidHex {
+		return errorHandling.NewAPIError(400, ClearLockout, "Invalid lockout id")
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, ClearLockout, err.Error())
+	}
+
+	result, err := LoginAttemptsCollection.DeleteOne(ctx, bson.M{"_id": idObj})
+	if err != nil {
+		return errorHandling.NewAPIError(500, ClearLockout, err.Error())
+	}
+	if result.DeletedCount == 0 {
+		return errorHandling.NewAPIError(404, ClearLockout, "Lockout not found")
+	}
+	return nil
+}
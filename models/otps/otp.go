@@ -1,28 +1,53 @@
 package otps
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"example/aibooks-backend/config"
 	"example/aibooks-backend/errorHandling"
-	"math/rand"
+	"example/aibooks-backend/utils"
+	"math/big"
+	"os"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Otp struct {
-	Id        primitive.ObjectID `bson:"_id" json:"id"`
-	Email     string             `bson:"email" json:"email"`
-	Otp       string             `bson:"otp" json:"otp"`
-	ExpiresAt primitive.DateTime `bson:"expires_at" json:"expires_at"`
-	UpdatedAt primitive.DateTime `bson:"updated_at" json:"updated_at"`
+	Id             primitive.ObjectID `bson:"_id" json:"id"`
+	Email          string             `bson:"email" json:"email"`
+	Purpose        string             `bson:"purpose" json:"purpose"`
+	OtpHash        string             `bson:"otp_hash" json:"-"`
+	FailedAttempts int                `bson:"failed_attempts" json:"failed_attempts"`
+	ExpiresAt      primitive.DateTime `bson:"expires_at" json:"expires_at"`
+	UpdatedAt      primitive.DateTime `bson:"updated_at" json:"updated_at"`
 }
 
+// An OTP can only be verified for the purpose it was issued for.
+const (
+	PurposeSignup          = "signup"
+	PurposePasswordReset   = "password_reset"
+	PurposeMagicLink       = "magic_link"
+	PurposeAccountDeletion = "account_deletion"
+	PurposeEmailChange     = "email_change"
+)
+
+var MagicLinkTTL = 15 * time.Minute
+
+// MaxFailedAttempts is the number of wrong guesses after which an OTP stops working.
+const MaxFailedAttempts = 5
+
 var OtpsCollectionName string = "otps"
 var OtpsCollection *mongo.Collection
 
-func GenerateAndSaveOtpFor(email string) (string, error) {
+func CreateIndexes() error {
 	if OtpsCollection == nil {
 		OtpsCollection = config.GetCollection(OtpsCollectionName)
 	}
@@ -30,56 +55,107 @@ func GenerateAndSaveOtpFor(email string) (string, error) {
 	ctx, cancel := config.GetDBCtx()
 	defer cancel()
 
-	var existingOtp Otp
-	err := OtpsCollection.FindOne(ctx, bson.M{"email": email}).Decode(&existingOtp)
-	if err == nil {
-		if time.Now().Before(existingOtp.UpdatedAt.Time().Add(60 * time.Second)) {
-			return "", errorHandling.ErrTooSoon
-		}
-
-		// Update existing OTP
-		generatedOtp := generateOtp(6)
-		update := bson.M{
-			"$set": bson.M{
-				"otp":        generatedOtp,
-				"expires_at": primitive.NewDateTimeFromTime(time.Now().Add(time.Minute * 30)),
-				"updated_at": primitive.NewDateTimeFromTime(time.Now()),
-			},
-		}
-		_, err = OtpsCollection.UpdateOne(ctx, bson.M{"_id": existingOtp.Id}, update)
-		if err != nil {
-			return "", err
-		}
-		return generatedOtp, nil
+	_, err := OtpsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}, {Key: "purpose", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
 	}
+	return nil
+}
 
-	// Insert new OTP
-	generatedOtp := generateOtp(6)
-	otp := Otp{
-		Id:        primitive.NewObjectID(),
-		Email:     email,
-		Otp:       generatedOtp,
-		ExpiresAt: primitive.NewDateTimeFromTime(time.Now().Add(time.Minute * 30)),
-		UpdatedAt: primitive.NewDateTimeFromTime(time.Now()),
+func GenerateAndSaveOtpFor(email string, purpose string) (string, error) {
+	generatedOtp, err := generateOtp(6)
+	if err != nil {
+		return "", err
 	}
 
-	_, err = OtpsCollection.InsertOne(ctx, otp)
+	return generatedOtp, saveCodeFor(email, purpose, generatedOtp, time.Minute*30)
+}
+
+// GenerateAndSaveMagicLinkNonceFor stores a long random nonce instead of a 6 digit code,
+// with the same hashing, throttling and single use rules as an OTP.
+func GenerateAndSaveMagicLinkNonceFor(email string) (string, error) {
+	nonce, err := utils.GenerateRandomToken(32)
 	if err != nil {
 		return "", err
 	}
-	return generatedOtp, nil
+
+	return nonce, saveCodeFor(email, PurposeMagicLink, nonce, MagicLinkTTL)
 }
 
-func generateOtp(length int) string {
+func saveCodeFor(email string, purpose string, code string, ttl time.Duration) error {
+	if OtpsCollection == nil {
+		OtpsCollection = config.GetCollection(OtpsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	var existingOtp Otp
+	err := OtpsCollection.FindOne(ctx, bson.M{"email": email, "purpose": purpose}).Decode(&existingOtp)
+	if err == nil && time.Now().Before(existingOtp.UpdatedAt.Time().Add(60*time.Second)) {
+		return errorHandling.ErrTooSoon
+	}
+
+	otpHash, err := hashOtp(email, purpose, code)
+	if err != nil {
+		return err
+	}
+
+	// Upsert so a resend replaces the previous code and resets its attempt counter
+	update := bson.M{
+		"$set": bson.M{
+			"otp_hash":        otpHash,
+			"failed_attempts": 0,
+			"expires_at":      primitive.NewDateTimeFromTime(time.Now().Add(ttl)),
+			"updated_at":      primitive.NewDateTimeFromTime(time.Now()),
+		},
+		"$setOnInsert": bson.M{
+			"_id": primitive.NewObjectID(),
+		},
+	}
+	_, err = OtpsCollection.UpdateOne(ctx, bson.M{"email": email, "purpose": purpose}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func generateOtp(length int) (string, error) {
 	digits := []rune("0123456789")
 	b := make([]rune, length)
 	for i := range b {
-		b[i] = digits[rand.Intn(len(digits))]
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(digits))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = digits[n.Int64()]
 	}
-	return string(b)
+	return string(b), nil
 }
 
-func CompareOtp(email string, otp string) bool {
+// hashOtp keys the hash with OTP_SECRET and binds it to the email and purpose,
+// so a leaked otps collection can't be brute forced offline.
+func hashOtp(email string, purpose string, otp string) (string, error) {
+	secret := os.Getenv("OTP_SECRET")
+	if secret == "" {
+		return "", errors.New("OTP_SECRET not set")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + ":" + email + ":" + otp))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ConsumeOtp reports whether otp is valid for the email and purpose. A valid OTP is
+// deleted in the same operation so it can't be used twice; a wrong one counts as a
+// failed attempt and locks the OTP after MaxFailedAttempts.
+func ConsumeOtp(email string, otp string, purpose string) bool {
 	if OtpsCollection == nil {
 		OtpsCollection = config.GetCollection(OtpsCollectionName)
 	}
@@ -87,19 +163,34 @@ func CompareOtp(email string, otp string) bool {
 	ctx, cancel := config.GetDBCtx()
 	defer cancel()
 
-	var o Otp
-	err := OtpsCollection.FindOne(ctx, bson.M{"email": email}).Decode(&o)
+	otpHash, err := hashOtp(email, purpose, otp)
 	if err != nil {
 		return false
 	}
 
-	if o.Otp != otp {
-		return false
+	err = OtpsCollection.FindOneAndDelete(ctx, bson.M{
+		"email":           email,
+		"purpose":         purpose,
+		"otp_hash":        otpHash,
+		"failed_attempts": bson.M{"$lt": MaxFailedAttempts},
+		"expires_at":      bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())},
+	}).Err()
+	if err == nil {
+		return true
 	}
 
-	if o.ExpiresAt.Time().Before(time.Now()) {
-		return false
+	OtpsCollection.UpdateOne(ctx, bson.M{"email": email, "purpose": purpose}, bson.M{"$inc": bson.M{"failed_attempts": 1}})
+	return false
+}
+
+func DeleteOtpsByEmail(ctx context.Context, email string) error {
+	if OtpsCollection == nil {
+		OtpsCollection = config.GetCollection(OtpsCollectionName)
 	}
 
-	return true
+	_, err := OtpsCollection.DeleteMany(ctx, bson.M{"email": email})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteOtpsByEmail, err.Error())
+	}
+	return nil
 }
@@ -0,0 +1,80 @@
+package otps
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateOtp(t *testing.T) {
+	for _, length := range []int{4, 6, 8} {
+		seen := map[string]bool{}
+		for i := 0; i < 50; i++ {
+			otp, err := generateOtp(length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(otp) != length {
+				t.Fatalf("generateOtp(%d) = %q, want %d characters", length, otp, length)
+			}
+			if strings.Trim(otp, "0123456789") != "" {
+				t.Fatalf("generateOtp(%d) = %q, want only digits", length, otp)
+			}
+			seen[otp] = true
+		}
+		// 50 draws out of at least 10^4 codes all colliding would mean the randomness is broken
+		if len(seen) < 2 {
+			t.Errorf("generateOtp(%d) returned the same code 50 times", length)
+		}
+	}
+}
+
+func TestHashOtp(t *testing.T) {
+	t.Setenv("OTP_SECRET", "first-secret")
+	first, err := hashOtp("reader@example.com", PurposeSignup, "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := hashOtp("reader@example.com", PurposeSignup, "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != again {
+		t.Errorf("hash changed between calls with the same key: %q, %q", first, again)
+	}
+
+	tests := []struct {
+		name    string
+		email   string
+		purpose string
+		otp     string
+	}{
+		{"other code", "reader@example.com", PurposeSignup, "123457"},
+		{"other email", "writer@example.com", PurposeSignup, "123456"},
+		{"other purpose", "reader@example.com", PurposePasswordReset, "123456"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := hashOtp(tt.email, tt.purpose, tt.otp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash == first {
+				t.Errorf("hash equals the one of the original code")
+			}
+		})
+	}
+
+	t.Setenv("OTP_SECRET", "second-secret")
+	otherKey, err := hashOtp("reader@example.com", PurposeSignup, "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherKey == first {
+		t.Error("hash is the same under a different OTP_SECRET")
+	}
+
+	t.Setenv("OTP_SECRET", "")
+	if _, err := hashOtp("reader@example.com", PurposeSignup, "123456"); err == nil {
+		t.Error("hashOtp succeeded without OTP_SECRET")
+	}
+}
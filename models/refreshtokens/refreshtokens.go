@@ -0,0 +1,219 @@
+package refreshtokens
+
+import (
+	"context"
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RefreshToken struct {
+	Id        primitive.ObjectID `bson:"_id" json:"id"`
+	UserId    primitive.ObjectID `bson:"userId" json:"userId"`
+	FamilyId  primitive.ObjectID `bson:"familyId" json:"familyId"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	Used      bool               `bson:"used" json:"used"`
+	Revoked   bool               `bson:"revoked" json:"revoked"`
+	ExpiresAt primitive.DateTime `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt primitive.DateTime `bson:"createdAt" json:"createdAt"`
+}
+
+var RefreshTokensCollectionName string = "refreshtokens"
+var RefreshTokensCollection *mongo.Collection
+
+var RefreshTokenTTL = 30 * 24 * time.Hour
+
+func CreateIndexes() error {
+	if RefreshTokensCollection == nil {
+		RefreshTokensCollection = config.GetCollection(RefreshTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := RefreshTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "familyId", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+// IssueRefreshToken stores a new token in the given family and returns the raw token.
+// The family id is the id of the login session the token belongs to.
+func IssueRefreshToken(userId primitive.ObjectID, familyId primitive.ObjectID) (string, error) {
+	if RefreshTokensCollection == nil {
+		RefreshTokensCollection = config.GetCollection(RefreshTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	raw, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", errorHandling.NewAPIError(500, IssueRefreshToken, err.Error())
+	}
+
+	token := RefreshToken{
+		Id:        primitive.NewObjectID(),
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: primitive.NewDateTimeFromTime(time.Now().Add(RefreshTokenTTL)),
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	_, err = RefreshTokensCollection.InsertOne(ctx, token)
+	if err != nil {
+		return "", errorHandling.NewAPIError(500, IssueRefreshToken, err.Error())
+	}
+	return raw, nil
+}
+
+// GetRefreshToken looks a raw token up whatever its state, e.g. to find the session
+// a logout belongs to after the access token has expired.
+func GetRefreshToken(raw string) (RefreshToken, error) {
+	if RefreshTokensCollection == nil {
+		RefreshTokensCollection = config.GetCollection(RefreshTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	var token RefreshToken
+	err := RefreshTokensCollection.FindOne(ctx, bson.M{"tokenHash": utils.HashToken(raw)}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return token, errorHandling.ErrInvalidToken
+	} else if err != nil {
+		return token, errorHandling.NewAPIError(500, GetRefreshToken, err.Error())
+	}
+	return token, nil
+}
+
+// RotateRefreshToken consumes a refresh token and issues its successor in the same family.
+// Presenting a token that was already used revokes the whole family.
+func RotateRefreshToken(raw string) (RefreshToken, string, error) {
+	if RefreshTokensCollection == nil {
+		RefreshTokensCollection = config.GetCollection(RefreshTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	var current RefreshToken
+	err := RefreshTokensCollection.FindOne(ctx, bson.M{"tokenHash": utils.HashToken(raw)}).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		return current, "", errorHandling.ErrInvalidToken
+	} else if err != nil {
+		return current, "", errorHandling.NewAPIError(500, RotateRefreshToken, err.Error())
+	}
+
+	if current.Revoked {
+		return current, "", errorHandling.ErrInvalidToken
+	}
+
+	if current.ExpiresAt.Time().Before(time.Now()) {
+		return current, "", errorHandling.ErrTokenExpired
+	}
+
+	// Mark as used only if nobody else did first, so concurrent reuse is caught too
+	result, err := RefreshTokensCollection.UpdateOne(ctx,
+		bson.M{"_id": current.Id, "used": false, "revoked": false},
+		bson.M{"$set": bson.M{"used": true}},
+	)
+	if err != nil {
+		return current, "", errorHandling.NewAPIError(500, RotateRefreshToken, err.Error())
+	}
+
+	if result.ModifiedCount == 0 {
+		if err := RevokeFamily(current.FamilyId); err != nil {
+			return current, "", err
+		}
+		return current, "", errorHandling.ErrTokenReused
+	}
+
+	next, err := IssueRefreshToken(current.UserId, current.FamilyId)
+	if err != nil {
+		return current, "", err
+	}
+
+	return current, next, nil
+}
+
+func RevokeFamily(familyId primitive.ObjectID) error {
+	if RefreshTokensCollection == nil {
+		RefreshTokensCollection = config.GetCollection(RefreshTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := RefreshTokensCollection.UpdateMany(ctx, bson.M{"familyId": familyId}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, RevokeFamily, err.Error())
+	}
+	return nil
+}
+
+func RevokeAllByUserId(userId primitive.ObjectID) error {
+	if RefreshTokensCollection == nil {
+		RefreshTokensCollection = config.GetCollection(RefreshTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := RefreshTokensCollection.UpdateMany(ctx, bson.M{"userId": userId, "revoked": false}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, RevokeAllByUserId, err.Error())
+	}
+	return nil
+}
+
+// RevokeOtherFamilies revokes the user's refresh tokens outside of keepFamilyId.
+func RevokeOtherFamilies(userId primitive.ObjectID, keepFamilyId primitive.ObjectID) error {
+	if RefreshTokensCollection == nil {
+		RefreshTokensCollection = config.GetCollection(RefreshTokensCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := RefreshTokensCollection.UpdateMany(ctx,
+		bson.M{"userId": userId, "familyId": bson.M{"$ne": keepFamilyId}, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return errorHandling.NewAPIError(500, RevokeOtherFamilies, err.Error())
+	}
+	return nil
+}
+
+func DeleteByUserId(ctx context.Context, userId primitive.ObjectID) error {
+	if RefreshTokensCollection == nil {
+		RefreshTokensCollection = config.GetCollection(RefreshTokensCollectionName)
+	}
+
+	_, err := RefreshTokensCollection.DeleteMany(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteByUserId, err.Error())
+	}
+	return nil
+}
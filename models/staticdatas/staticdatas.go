@@ -36,3 +36,28 @@ func GetStaticDataByType(dataType string) (StaticData, error) {
 
 	return staticData, nil
 }
+
+// GenresDataType is the static data holding the catalog's genres as a list of names.
+const GenresDataType = "genres"
+
+// GetGenres returns the genre names books may be filed under.
+func GetGenres() ([]string, error) {
+	staticData, err := GetStaticDataByType(GenresDataType)
+	if err != nil {
+		return nil, err
+	}
+
+	rawGenres, ok := staticData.Data.(primitive.A)
+	if !ok {
+		return nil, errorHandling.NewAPIError(500, GetGenres, "Genres must be a list")
+	}
+	genres := make([]string, 0, len(rawGenres))
+	for _, rawGenre := range rawGenres {
+		genre, ok := rawGenre.(string)
+		if !ok {
+			return nil, errorHandling.NewAPIError(500, GetGenres, "Genres must be a list of names")
+		}
+		genres = append(genres, genre)
+	}
+	return genres, nil
+}
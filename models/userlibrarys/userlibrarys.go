@@ -4,6 +4,7 @@ import (
 	"context"
 	"example/aibooks-backend/config"
 	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/activities"
 	"example/aibooks-backend/models/books"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -12,10 +13,11 @@ import (
 )
 
 type UserLibrary struct {
-	Id         primitive.ObjectID   `bson:"_id" json:"id"`
-	UserId     primitive.ObjectID   `bson:"userId" json:"userId"`
-	BookIds    []primitive.ObjectID `bson:"bookIds" json:"bookIds"`
-	TotalBooks int64                `bson:"totalBooks" json:"totalBooks"`
+	Id              primitive.ObjectID   `bson:"_id" json:"id"`
+	UserId          primitive.ObjectID   `bson:"userId" json:"userId"`
+	BookIds         []primitive.ObjectID `bson:"bookIds" json:"bookIds"`
+	FinishedBookIds []primitive.ObjectID `bson:"finishedBookIds,omitempty" json:"finishedBookIds"`
+	TotalBooks      int64                `bson:"totalBooks" json:"totalBooks"`
 }
 
 type UserLibraryResponse struct {
@@ -110,7 +112,43 @@ func AddBookToLibrary(userId primitive.ObjectID, bookId primitive.ObjectID) erro
 		}
 	}
 
-	return nil
+	return activities.RecordActivity(ctx, activities.Activity{
+		ActorId: userId,
+		Type:    activities.TypeLibraryAdded,
+		BookId:  bookId,
+	})
+}
+
+// MarkBookFinished marks a book in the user's library as finished, adding it to the
+// library first if needed. Marking it again does nothing.
+func MarkBookFinished(userId primitive.ObjectID, bookId primitive.ObjectID) error {
+	if UserLibraryCollection == nil {
+		UserLibraryCollection = config.GetCollection(UserLibraryCollectionName)
+	}
+
+	if err := AddBookToLibrary(userId, bookId); err != nil {
+		return err
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	result, err := UserLibraryCollection.UpdateOne(ctx,
+		bson.M{"userId": userId, "finishedBookIds": bson.M{"$ne": bookId}},
+		bson.M{"$addToSet": bson.M{"finishedBookIds": bookId}},
+	)
+	if err != nil {
+		return errorHandling.NewAPIError(500, MarkBookFinished, err.Error())
+	}
+	if result.ModifiedCount == 0 {
+		return nil
+	}
+
+	return activities.RecordActivity(ctx, activities.Activity{
+		ActorId: userId,
+		Type:    activities.TypeFinished,
+		BookId:  bookId,
+	})
 }
 
 func RemoveBookFromLibrary(userId primitive.ObjectID, bookId primitive.ObjectID) error {
@@ -123,7 +161,7 @@ func RemoveBookFromLibrary(userId primitive.ObjectID, bookId primitive.ObjectID)
 
 	filter := bson.M{"userId": userId}
 	update := bson.M{
-		"$pull": bson.M{"bookIds": bookId},
+		"$pull": bson.M{"bookIds": bookId, "finishedBookIds": bookId},
 		"$inc":  bson.M{"totalBooks": -1},
 	}
 
@@ -136,7 +174,7 @@ func RemoveBookFromLibrary(userId primitive.ObjectID, bookId primitive.ObjectID)
 		return errorHandling.NewAPIError(404, RemoveBookFromLibrary, "Library not found")
 	}
 
-	return nil
+	return activities.DeleteBookActivities(ctx, userId, bookId, activities.LibraryTypes)
 }
 
 func GetLibraryByUserId(userId primitive.ObjectID, page int64, limit int64) (UserLibraryResponse, error) {
@@ -196,3 +234,81 @@ func GetLibraryByUserId(userId primitive.ObjectID, page int64, limit int64) (Use
 
 	return library, nil
 }
+
+func DeleteLibraryByUserId(ctx context.Context, userId primitive.ObjectID) error {
+	if UserLibraryCollection == nil {
+		UserLibraryCollection = config.GetCollection(UserLibraryCollectionName)
+	}
+
+	_, err := UserLibraryCollection.DeleteOne(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteLibraryByUserId, err.Error())
+	}
+	return nil
+}
+
+// RemoveBookFromAllLibraries takes a deleted book out of every library that holds it.
+// Meant to run inside a transaction.
+func RemoveBookFromAllLibraries(ctx context.Context, bookId primitive.ObjectID) error {
+	if UserLibraryCollection == nil {
+		UserLibraryCollection = config.GetCollection(UserLibraryCollectionName)
+	}
+
+	_, err := UserLibraryCollection.UpdateMany(ctx,
+		bson.M{"bookIds": bookId},
+		bson.M{
+			"$pull": bson.M{"bookIds": bookId, "finishedBookIds": bookId},
+			"$inc":  bson.M{"totalBooks": -1},
+		},
+	)
+	if err != nil {
+		return errorHandling.NewAPIError(500, RemoveBookFromAllLibraries, err.Error())
+	}
+	return nil
+}
+
+type LibraryEntry struct {
+	BookId primitive.ObjectID `bson:"_id" json:"bookId"`
+	Title  string             `bson:"title" json:"title"`
+}
+
+// GetLibraryEntriesByUserId returns every book in the user's library with its title, unpaginated.
+func GetLibraryEntriesByUserId(userId primitive.ObjectID) ([]LibraryEntry, error) {
+	if UserLibraryCollection == nil {
+		UserLibraryCollection = config.GetCollection(UserLibraryCollectionName)
+	}
+
+	entries := []LibraryEntry{}
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"userId": userId}},
+		{"$unwind": "$bookIds"},
+		{
+			"$lookup": bson.M{
+				"from":         "bookdatas",
+				"localField":   "bookIds",
+				"foreignField": "_id",
+				"as":           "book",
+			},
+		},
+		{
+			"$project": bson.M{
+				"_id":   "$bookIds",
+				"title": bson.M{"$ifNull": []interface{}{bson.M{"$first": "$book.title"}, ""}},
+			},
+		},
+	}
+
+	cursor, err := UserLibraryCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return entries, errorHandling.NewAPIError(500, GetLibraryEntriesByUserId, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &entries); err != nil {
+		return entries, errorHandling.NewAPIError(500, GetLibraryEntriesByUserId, err.Error())
+	}
+	return entries, nil
+}
@@ -1,13 +1,18 @@
 package users
 
 import (
+	"context"
 	"example/aibooks-backend/config"
 	"example/aibooks-backend/errorHandling"
+	"example/aibooks-backend/models/blocks"
+	"slices"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Users struct {
@@ -16,13 +21,117 @@ type Users struct {
 	EmailVerified bool               `bson:"email_verified" json:"email_verified"`
 	FirstName     string             `bson:"first_name" json:"first_name"`
 	LastName      string             `bson:"last_name" json:"last_name"`
-	Password      string             `bson:"password" json:"password"`
+	Password      string             `bson:"password" json:"-"`
+	Roles         []string           `bson:"roles" json:"roles"`
 	UpdatedAt     primitive.DateTime `bson:"updated_at" json:"updated_at"`
+
+	TotpEnabled       bool     `bson:"totp_enabled" json:"totp_enabled"`
+	TotpSecret        string   `bson:"totp_secret,omitempty" json:"-"`
+	TotpPendingSecret string   `bson:"totp_pending_secret,omitempty" json:"-"`
+	TotpLastStep      int64    `bson:"totp_last_step,omitempty" json:"-"`
+	RecoveryCodes     []string `bson:"recovery_codes,omitempty" json:"-"`
+
+	DeletionScheduledAt *primitive.DateTime `bson:"deletion_scheduled_at,omitempty" json:"deletion_scheduled_at,omitempty"`
+
+	DisplayName     string              `bson:"display_name,omitempty" json:"display_name"`
+	Bio             string              `bson:"bio,omitempty" json:"bio"`
+	AvatarFileId    *primitive.ObjectID `bson:"avatar_file_id,omitempty" json:"-"`
+	FavouriteGenres []string            `bson:"favourite_genres,omitempty" json:"favourite_genres"`
+	Preferences     Preferences         `bson:"preferences,omitempty" json:"preferences"`
+	PendingEmail    string              `bson:"pending_email,omitempty" json:"-"`
+	Privacy         Privacy             `bson:"privacy,omitempty" json:"privacy"`
+}
+
+type Preferences struct {
+	Theme    string `bson:"theme,omitempty" json:"theme,omitempty"`
+	Language string `bson:"language,omitempty" json:"language,omitempty"`
+}
+
+// Privacy controls what other users can see. A private profile hides both the
+// library and the ratings.
+type Privacy struct {
+	PrivateProfile bool `bson:"private_profile" json:"private_profile"`
+	HideLibrary    bool `bson:"hide_library" json:"hide_library"`
+	HideRatings    bool `bson:"hide_ratings" json:"hide_ratings"`
+}
+
+// RatingsVisibleTo reports whether viewerId may see this user's ratings and reviews.
+// viewerId is primitive.NilObjectID for anonymous viewers.
+func (u Users) RatingsVisibleTo(viewerId primitive.ObjectID) bool {
+	return u.Id == viewerId || !(u.Privacy.PrivateProfile || u.Privacy.HideRatings)
+}
+
+func (u Users) LibraryVisibleTo(viewerId primitive.ObjectID) bool {
+	return u.Id == viewerId || !(u.Privacy.PrivateProfile || u.Privacy.HideLibrary)
+}
+
+func (u Users) ProfileVisibleTo(viewerId primitive.ObjectID) bool {
+	return u.Id == viewerId || !u.Privacy.PrivateProfile
+}
+
+// ProfileUpdate holds the editable profile fields. Nil fields are left unchanged.
+type ProfileUpdate struct {
+	DisplayName     *string
+	Bio             *string
+	FavouriteGenres *[]string
+	Theme           *string
+	Language        *string
+	PrivateProfile  *bool
+	HideLibrary     *bool
+	HideRatings     *bool
+}
+
+const (
+	RoleReader = "reader"
+	RoleAuthor = "author"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var ValidRoles = []string{RoleReader, RoleAuthor, RoleEditor, RoleAdmin}
+
+// GetRoles returns the user's roles, treating accounts created before roles existed as readers.
+func (u Users) GetRoles() []string {
+	if len(u.Roles) == 0 {
+		return []string{RoleReader}
+	}
+	return u.Roles
 }
 
 var UsersCollectionName string = "users"
 var UsersCollection *mongo.Collection
 
+// NormalizeEmail is the form emails are stored and looked up in. Anything keyed by
+// email, like otps and login attempts, should use it too.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// CreateIndexes keeps emails unique. The index compares exact strings, so accounts
+// created before emails were normalized have to be migrated before it can be relied
+// on, e.g. in mongosh:
+//
+//	db.users.find({email: /[A-Z]|^\s|\s$/}).forEach(u => db.users.updateOne({_id: u._id}, {$set: {email: u.email.trim().toLowerCase()}}))
+//
+// Two accounts that only differ in case make that update fail and need merging by hand.
+func CreateIndexes() error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := UsersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
 func AddUser(user Users) (primitive.ObjectID, error) {
 	if UsersCollection == nil {
 		UsersCollection = config.GetCollection(UsersCollectionName)
@@ -31,29 +140,26 @@ func AddUser(user Users) (primitive.ObjectID, error) {
 	ctx, cancel := config.GetDBCtx()
 	defer cancel()
 
+	user.Email = NormalizeEmail(user.Email)
 	user.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+	if len(user.Roles) == 0 {
+		user.Roles = []string{RoleReader}
+	}
 
-	var existingUser Users
-	err := UsersCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&existingUser)
-	if err == nil && existingUser.Email == user.Email {
-		_, err = UsersCollection.UpdateByID(ctx, existingUser.Id, bson.M{"$set": bson.M{
-			"email":          user.Email,
-			"email_verified": user.EmailVerified,
-			"first_name":     user.FirstName,
-			"last_name":      user.LastName,
-			"password":       user.Password,
-			"updated_at":     user.UpdatedAt,
-		}})
-		if err != nil {
-			return primitive.NilObjectID, errorHandling.NewAPIError(500, AddUser, err.Error())
-		}
-		return existingUser.Id, nil
+	count, err := UsersCollection.CountDocuments(ctx, bson.M{"email": user.Email})
+	if err != nil {
+		return primitive.NilObjectID, errorHandling.NewAPIError(500, AddUser, err.Error())
+	}
+	if count > 0 {
+		return primitive.NilObjectID, errorHandling.NewAPIError(409, AddUser, "User already exists")
 	}
 
 	user.Id = primitive.NewObjectID()
 
 	doc, err := UsersCollection.InsertOne(ctx, user)
-	if err != nil {
+	if mongo.IsDuplicateKeyError(err) {
+		return primitive.NilObjectID, errorHandling.NewAPIError(409, AddUser, "User already exists")
+	} else if err != nil {
 		return primitive.NilObjectID, errorHandling.NewAPIError(500, AddUser, err.Error())
 	}
 
@@ -86,6 +192,25 @@ func GetUserById(id string) (Users, error) {
 	return user, nil
 }
 
+// GetUserForViewer loads a user whose profile is about to be shown to viewerId. If the
+// user has blocked the viewer their profile is treated as private, so only the public
+// card is visible.
+func GetUserForViewer(id string, viewerId primitive.ObjectID) (Users, error) {
+	user, err := GetUserById(id)
+	if err != nil {
+		return user, err
+	}
+
+	blocked, err := blocks.IsBlocked(user.Id, viewerId)
+	if err != nil {
+		return user, err
+	}
+	if blocked {
+		user.Privacy.PrivateProfile = true
+	}
+	return user, nil
+}
+
 func GetUserByEmail(email string) (Users, error) {
 	if UsersCollection == nil {
 		UsersCollection = config.GetCollection(UsersCollectionName)
@@ -95,7 +220,7 @@ func GetUserByEmail(email string) (Users, error) {
 	ctx, cancel := config.GetDBCtx()
 	defer cancel()
 
-	err := UsersCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := UsersCollection.FindOne(ctx, bson.M{"email": NormalizeEmail(email)}).Decode(&user)
 	if err == mongo.ErrNoDocuments {
 		return user, errorHandling.NewAPIError(404, err, "User not found")
 	} else if err != nil {
@@ -104,3 +229,449 @@ func GetUserByEmail(email string) (Users, error) {
 
 	return user, nil
 }
+
+func UpdatePassword(id primitive.ObjectID, password string) error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	result, err := UsersCollection.UpdateByID(ctx, id, bson.M{"$set": bson.M{
+		"password":   password,
+		"updated_at": primitive.NewDateTimeFromTime(time.Now()),
+	}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, UpdatePassword, err.Error())
+	}
+	if result.MatchedCount == 0 {
+		return errorHandling.NewAPIError(404, UpdatePassword, "User not found")
+	}
+	return nil
+}
+
+func SetPendingTotpSecret(id primitive.ObjectID, secret string) error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := UsersCollection.UpdateByID(ctx, id, bson.M{"$set": bson.M{
+		"totp_pending_secret": secret,
+		"updated_at":          primitive.NewDateTimeFromTime(time.Now()),
+	}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, SetPendingTotpSecret, err.Error())
+	}
+	return nil
+}
+
+// EnableTotp promotes the pending secret and replaces any recovery codes with the given hashes.
+func EnableTotp(id primitive.ObjectID, step int64, recoveryCodeHashes []string) error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	result, err := UsersCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "totp_pending_secret": bson.M{"$exists": true}},
+		bson.A{bson.M{"$set": bson.M{
+			"totp_enabled":   true,
+			"totp_secret":    "$totp_pending_secret",
+			"totp_last_step": step,
+			"recovery_codes": recoveryCodeHashes,
+			"updated_at":     primitive.NewDateTimeFromTime(time.Now()),
+		}}, bson.M{"$unset": "totp_pending_secret"}},
+	)
+	if err != nil {
+		return errorHandling.NewAPIError(500, EnableTotp, err.Error())
+	}
+	if result.MatchedCount == 0 {
+		return errorHandling.NewAPIError(404, EnableTotp, "No pending TOTP enrollment")
+	}
+	return nil
+}
+
+func DisableTotp(id primitive.ObjectID) error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := UsersCollection.UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{
+			"totp_enabled": false,
+			"updated_at":   primitive.NewDateTimeFromTime(time.Now()),
+		},
+		"$unset": bson.M{
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_last_step":      "",
+			"recovery_codes":      "",
+		},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DisableTotp, err.Error())
+	}
+	return nil
+}
+
+// UseTotpStep records step as used and reports false if it (or a later one) was used already.
+func UseTotpStep(id primitive.ObjectID, step int64) (bool, error) {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	result, err := UsersCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "totp_last_step": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"totp_last_step": step}},
+	)
+	if err != nil {
+		return false, errorHandling.NewAPIError(500, UseTotpStep, err.Error())
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode removes the code hash from the user and reports whether it was present.
+func UseRecoveryCode(id primitive.ObjectID, codeHash string) (bool, error) {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	result, err := UsersCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "recovery_codes": codeHash},
+		bson.M{"$pull": bson.M{"recovery_codes": codeHash}},
+	)
+	if err != nil {
+		return false, errorHandling.NewAPIError(500, UseRecoveryCode, err.Error())
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// GuardLastAdmin fails with 409 if id is the only admin, for changes that would take
+// the role away from them. It must run in a transaction together with that change.
+// It bumps roles_version on every other admin, so two transactions removing the last
+// two admins write the same documents. One of them then conflicts and is retried
+// against the committed state, which the guard refuses.
+func GuardLastAdmin(ctx context.Context, id primitive.ObjectID) error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	result, err := UsersCollection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$ne": id}, "roles": RoleAdmin},
+		bson.M{"$inc": bson.M{"roles_version": 1}},
+	)
+	if err != nil {
+		return errorHandling.NewAPIError(500, GuardLastAdmin, err.Error())
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	count, err := UsersCollection.CountDocuments(ctx, bson.M{"_id": id, "roles": RoleAdmin})
+	if err != nil {
+		return errorHandling.NewAPIError(500, GuardLastAdmin, err.Error())
+	}
+	if count > 0 {
+		return errorHandling.NewAPIError(409, GuardLastAdmin, "Can't remove the last admin")
+	}
+	return nil
+}
+
+func UpdateRoles(id string, roles []string) error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err == primitive.ErrInvalidHex {
+		return errorHandling.NewAPIError(400, UpdateRoles, "Invalid user id")
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, UpdateRoles, err.Error())
+	}
+
+	client := config.GetDB().Client()
+	session, err := client.StartSession()
+	if err != nil {
+		return errorHandling.NewAPIError(500, UpdateRoles, "Failed to start session")
+	}
+	defer session.EndSession(ctx)
+
+	// Someone has to be left who can hand out the admin role again
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if !slices.Contains(roles, RoleAdmin) {
+			if err := GuardLastAdmin(sessCtx, idObj); err != nil {
+				return nil, err
+			}
+		}
+
+		result, err := UsersCollection.UpdateByID(sessCtx, idObj, bson.M{"$set": bson.M{
+			"roles":      roles,
+			"updated_at": primitive.NewDateTimeFromTime(time.Now()),
+		}})
+		if err != nil {
+			return nil, errorHandling.NewAPIError(500, UpdateRoles, err.Error())
+		}
+		if result.MatchedCount == 0 {
+			return nil, errorHandling.NewAPIError(404, UpdateRoles, "User not found")
+		}
+		return nil, nil
+	})
+	if _, ok := err.(errorHandling.APIError); ok {
+		return err
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, UpdateRoles, err.Error())
+	}
+	return nil
+}
+
+func DeleteUserById(ctx context.Context, id primitive.ObjectID) error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	result, err := UsersCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteUserById, err.Error())
+	}
+	if result.DeletedCount == 0 {
+		return errorHandling.NewAPIError(404, DeleteUserById, "User not found")
+	}
+	return nil
+}
+
+// ScheduleDeletion marks the user for deletion at the given time, or cancels a scheduled deletion when at is nil.
+// The last admin can't be scheduled for deletion.
+func ScheduleDeletion(id primitive.ObjectID, at *time.Time) error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	client := config.GetDB().Client()
+	session, err := client.StartSession()
+	if err != nil {
+		return errorHandling.NewAPIError(500, ScheduleDeletion, "Failed to start session")
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		update := bson.M{"$unset": bson.M{"deletion_scheduled_at": ""}}
+		if at != nil {
+			if err := GuardLastAdmin(sessCtx, id); err != nil {
+				return nil, err
+			}
+			update = bson.M{"$set": bson.M{"deletion_scheduled_at": primitive.NewDateTimeFromTime(*at)}}
+		}
+
+		result, err := UsersCollection.UpdateByID(sessCtx, id, update)
+		if err != nil {
+			return nil, errorHandling.NewAPIError(500, ScheduleDeletion, err.Error())
+		}
+		if result.MatchedCount == 0 {
+			return nil, errorHandling.NewAPIError(404, ScheduleDeletion, "User not found")
+		}
+		return nil, nil
+	})
+	if _, ok := err.(errorHandling.APIError); ok {
+		return err
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, ScheduleDeletion, err.Error())
+	}
+	return nil
+}
+
+func GetUsersDueForDeletion(limit int64) ([]Users, error) {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	var users []Users
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	cursor, err := UsersCollection.Find(ctx,
+		bson.M{"deletion_scheduled_at": bson.M{"$lte": primitive.NewDateTimeFromTime(time.Now())}},
+		options.Find().SetLimit(limit),
+	)
+	if err != nil {
+		return users, errorHandling.NewAPIError(500, GetUsersDueForDeletion, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &users); err != nil {
+		return users, errorHandling.NewAPIError(500, GetUsersDueForDeletion, err.Error())
+	}
+	return users, nil
+}
+
+// UpdateProfile applies the non nil fields of update and returns the updated user.
+func UpdateProfile(id primitive.ObjectID, update ProfileUpdate) (Users, error) {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	var user Users
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	set := bson.M{"updated_at": primitive.NewDateTimeFromTime(time.Now())}
+	if update.DisplayName != nil {
+		set["display_name"] = *update.DisplayName
+	}
+	if update.Bio != nil {
+		set["bio"] = *update.Bio
+	}
+	if update.FavouriteGenres != nil {
+		set["favourite_genres"] = *update.FavouriteGenres
+	}
+	if update.Theme != nil {
+		set["preferences.theme"] = *update.Theme
+	}
+	if update.Language != nil {
+		set["preferences.language"] = *update.Language
+	}
+	if update.PrivateProfile != nil {
+		set["privacy.private_profile"] = *update.PrivateProfile
+	}
+	if update.HideLibrary != nil {
+		set["privacy.hide_library"] = *update.HideLibrary
+	}
+	if update.HideRatings != nil {
+		set["privacy.hide_ratings"] = *update.HideRatings
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := UsersCollection.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": set}, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, errorHandling.NewAPIError(404, UpdateProfile, "User not found")
+	} else if err != nil {
+		return user, errorHandling.NewAPIError(500, UpdateProfile, err.Error())
+	}
+	return user, nil
+}
+
+// SetAvatar points the user at a new avatar file, or removes it when fileId is nil,
+// and returns the previous file so the caller can delete it.
+func SetAvatar(id primitive.ObjectID, fileId *primitive.ObjectID) (*primitive.ObjectID, error) {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	var previous Users
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"updated_at": primitive.NewDateTimeFromTime(time.Now())}}
+	if fileId != nil {
+		update["$set"].(bson.M)["avatar_file_id"] = *fileId
+	} else {
+		update["$unset"] = bson.M{"avatar_file_id": ""}
+	}
+
+	err := UsersCollection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return nil, errorHandling.NewAPIError(404, SetAvatar, "User not found")
+	} else if err != nil {
+		return nil, errorHandling.NewAPIError(500, SetAvatar, err.Error())
+	}
+	return previous.AvatarFileId, nil
+}
+
+func SetPendingEmail(id primitive.ObjectID, email string) error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := UsersCollection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"pending_email": NormalizeEmail(email)}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, SetPendingEmail, err.Error())
+	}
+	return nil
+}
+
+// ConfirmEmailChange switches the user to their verified pending email. It fails with
+// 409 if another account took the address in the meantime.
+func ConfirmEmailChange(id primitive.ObjectID, email string) error {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	email = NormalizeEmail(email)
+	result, err := UsersCollection.UpdateOne(ctx, bson.M{"_id": id, "pending_email": email}, bson.M{
+		"$set": bson.M{
+			"email":          email,
+			"email_verified": true,
+			"updated_at":     primitive.NewDateTimeFromTime(time.Now()),
+		},
+		"$unset": bson.M{"pending_email": ""},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return errorHandling.NewAPIError(409, ConfirmEmailChange, "Email already in use")
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, ConfirmEmailChange, err.Error())
+	}
+	if result.MatchedCount == 0 {
+		return errorHandling.NewAPIError(404, ConfirmEmailChange, "No pending email change")
+	}
+	return nil
+}
+
+// GetPublicUsersByIds loads the given users with only the fields needed to show them
+// to others and to apply their privacy settings.
+func GetPublicUsersByIds(ids []primitive.ObjectID) ([]Users, error) {
+	if UsersCollection == nil {
+		UsersCollection = config.GetCollection(UsersCollectionName)
+	}
+
+	results := []Users{}
+	if len(ids) == 0 {
+		return results, nil
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{
+		"first_name":     1,
+		"last_name":      1,
+		"display_name":   1,
+		"avatar_file_id": 1,
+		"privacy":        1,
+	})
+	cursor, err := UsersCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, opts)
+	if err != nil {
+		return results, errorHandling.NewAPIError(500, GetPublicUsersByIds, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &results); err != nil {
+		return results, errorHandling.NewAPIError(500, GetPublicUsersByIds, err.Error())
+	}
+	return results, nil
+}
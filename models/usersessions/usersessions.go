@@ -0,0 +1,233 @@
+package usersessions
+
+import (
+	"context"
+	"example/aibooks-backend/config"
+	"example/aibooks-backend/errorHandling"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type UserSession struct {
+	Id         primitive.ObjectID `bson:"_id" json:"id"`
+	UserId     primitive.ObjectID `bson:"userId" json:"userId"`
+	UserAgent  string             `bson:"userAgent" json:"userAgent"`
+	Ip         string             `bson:"ip" json:"ip"`
+	Revoked    bool               `bson:"revoked" json:"revoked"`
+	CreatedAt  primitive.DateTime `bson:"createdAt" json:"createdAt"`
+	LastSeenAt primitive.DateTime `bson:"lastSeenAt" json:"lastSeenAt"`
+}
+
+var UserSessionsCollectionName string = "usersessions"
+var UserSessionsCollection *mongo.Collection
+
+// lastSeenInterval limits how often TouchSession writes to the session document.
+var lastSeenInterval = time.Minute
+
+func CreateIndexes() error {
+	if UserSessionsCollection == nil {
+		UserSessionsCollection = config.GetCollection(UserSessionsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := UserSessionsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "revoked", Value: 1}},
+	})
+	if err != nil {
+		return errorHandling.NewAPIError(500, CreateIndexes, err.Error())
+	}
+	return nil
+}
+
+func CreateSession(userId primitive.ObjectID, userAgent string, ip string) (primitive.ObjectID, error) {
+	if UserSessionsCollection == nil {
+		UserSessionsCollection = config.GetCollection(UserSessionsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	session := UserSession{
+		Id:         primitive.NewObjectID(),
+		UserId:     userId,
+		UserAgent:  userAgent,
+		Ip:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+
+	_, err := UserSessionsCollection.InsertOne(ctx, session)
+	if err != nil {
+		return primitive.NilObjectID, errorHandling.NewAPIError(500, CreateSession, err.Error())
+	}
+	return session.Id, nil
+}
+
+// IsSessionActive reports whether the session exists, belongs to the user and has not been revoked.
+func IsSessionActive(sessionId string, userId string) (bool, error) {
+	if UserSessionsCollection == nil {
+		UserSessionsCollection = config.GetCollection(UserSessionsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	sessionIdObj, err := primitive.ObjectIDFromHex(sessionId)
+	if err != nil {
+		return false, nil
+	}
+	userIdObj, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return false, nil
+	}
+
+	count, err := UserSessionsCollection.CountDocuments(ctx, bson.M{"_id": sessionIdObj, "userId": userIdObj, "revoked": false})
+	if err != nil {
+		return false, errorHandling.NewAPIError(500, IsSessionActive, err.Error())
+	}
+	return count > 0, nil
+}
+
+func TouchSession(sessionId string, ip string) error {
+	if UserSessionsCollection == nil {
+		UserSessionsCollection = config.GetCollection(UserSessionsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	sessionIdObj, err := primitive.ObjectIDFromHex(sessionId)
+	if err != nil {
+		return errorHandling.NewAPIError(400, TouchSession, "Invalid session id")
+	}
+
+	now := time.Now()
+	_, err = UserSessionsCollection.UpdateOne(ctx,
+		bson.M{"_id": sessionIdObj, "lastSeenAt": bson.M{"$lt": primitive.NewDateTimeFromTime(now.Add(-lastSeenInterval))}},
+		bson.M{"$set": bson.M{"lastSeenAt": primitive.NewDateTimeFromTime(now), "ip": ip}},
+	)
+	if err != nil {
+		return errorHandling.NewAPIError(500, TouchSession, err.Error())
+	}
+	return nil
+}
+
+func GetActiveSessionsByUserId(userId string) ([]UserSession, error) {
+	if UserSessionsCollection == nil {
+		UserSessionsCollection = config.GetCollection(UserSessionsCollectionName)
+	}
+
+	sessions := []UserSession{}
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	userIdObj, err := primitive.ObjectIDFromHex(userId)
+	if err == primitive.ErrInvalidHex {
+		return sessions, errorHandling.NewAPIError(400, GetActiveSessionsByUserId, "Invalid user id")
+	} else if err != nil {
+		return sessions, errorHandling.NewAPIError(500, GetActiveSessionsByUserId, err.Error())
+	}
+
+	cursor, err := UserSessionsCollection.Find(ctx,
+		bson.M{"userId": userIdObj, "revoked": false},
+		options.Find().SetSort(bson.M{"lastSeenAt": -1}),
+	)
+	if err != nil {
+		return sessions, errorHandling.NewAPIError(500, GetActiveSessionsByUserId, err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return sessions, errorHandling.NewAPIError(500, GetActiveSessionsByUserId, err.Error())
+	}
+	return sessions, nil
+}
+
+func RevokeSession(sessionId string, userId string) error {
+	if UserSessionsCollection == nil {
+		UserSessionsCollection = config.GetCollection(UserSessionsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	sessionIdObj, err := primitive.ObjectIDFromHex(sessionId)
+	if err == primitive.ErrInvalidHex {
+		return errorHandling.NewAPIError(400, RevokeSession, "Invalid session id")
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, RevokeSession, err.Error())
+	}
+
+	userIdObj, err := primitive.ObjectIDFromHex(userId)
+	if err == primitive.ErrInvalidHex {
+		return errorHandling.NewAPIError(400, RevokeSession, "Invalid user id")
+	} else if err != nil {
+		return errorHandling.NewAPIError(500, RevokeSession, err.Error())
+	}
+
+	result, err := UserSessionsCollection.UpdateOne(ctx,
+		bson.M{"_id": sessionIdObj, "userId": userIdObj},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return errorHandling.NewAPIError(500, RevokeSession, err.Error())
+	}
+	if result.MatchedCount == 0 {
+		return errorHandling.NewAPIError(404, RevokeSession, "Session not found")
+	}
+	return nil
+}
+
+func RevokeAllSessions(userId primitive.ObjectID) error {
+	if UserSessionsCollection == nil {
+		UserSessionsCollection = config.GetCollection(UserSessionsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := UserSessionsCollection.UpdateMany(ctx, bson.M{"userId": userId, "revoked": false}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return errorHandling.NewAPIError(500, RevokeAllSessions, err.Error())
+	}
+	return nil
+}
+
+// RevokeOtherSessions ends every session of the user except keepSessionId. Pass
+// primitive.NilObjectID to end all of them.
+func RevokeOtherSessions(userId primitive.ObjectID, keepSessionId primitive.ObjectID) error {
+	if UserSessionsCollection == nil {
+		UserSessionsCollection = config.GetCollection(UserSessionsCollectionName)
+	}
+
+	ctx, cancel := config.GetDBCtx()
+	defer cancel()
+
+	_, err := UserSessionsCollection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$ne": keepSessionId}, "userId": userId, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return errorHandling.NewAPIError(500, RevokeOtherSessions, err.Error())
+	}
+	return nil
+}
+
+func DeleteSessionsByUserId(ctx context.Context, userId primitive.ObjectID) error {
+	if UserSessionsCollection == nil {
+		UserSessionsCollection = config.GetCollection(UserSessionsCollectionName)
+	}
+
+	_, err := UserSessionsCollection.DeleteMany(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return errorHandling.NewAPIError(500, DeleteSessionsByUserId, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"example/aibooks-backend/controllers/admin"
+	"example/aibooks-backend/middleware"
+	"example/aibooks-backend/models/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAdminRoutes(r *gin.RouterGroup) {
+	adminGroup := r.Group("/admin")
+	adminGroup.Use(middleware.IsAuthenticated, middleware.RequireSession, middleware.RequireRole(users.RoleAdmin))
+	{
+		adminGroup.GET("/users/:id", admin.GetUser)
+		adminGroup.PUT("/users/:id/roles", admin.UpdateUserRoles)
+
+		adminGroup.GET("/lockouts", admin.GetLockouts)
+		adminGroup.DELETE("/lockouts/:id", admin.ClearLockout)
+
+		adminGroup.GET("/emails", admin.GetEmails)
+		adminGroup.GET("/emails/:id", admin.GetEmail)
+		adminGroup.POST("/emails/:id/retry", admin.RetryEmail)
+
+		adminGroup.POST("/books", admin.CreateBook)
+		adminGroup.PUT("/books/:id", admin.ReplaceBook)
+		adminGroup.PATCH("/books/:id", admin.PatchBook)
+		adminGroup.DELETE("/books/:id", admin.DeleteBook)
+		adminGroup.PUT("/books/:id/pdf", admin.UploadBookPdf)
+		adminGroup.PUT("/books/:id/cover", admin.UploadBookCover)
+	}
+}
@@ -11,14 +11,49 @@ func RegisterAuthRoutes(r *gin.RouterGroup) {
 	authGrp := r.Group("/auth")
 
 	{
+		authGrp.GET("/csrf", auth.GetCsrfToken)
+
 		authGrp.POST("/login", auth.Login)
 
 		authGrp.POST("/sendOtp", auth.SendOtp)
 
 		authGrp.POST("/create", auth.CreateAccount)
 
-		authGrp.Use(middleware.IsAuthenticated).GET("/logout", auth.Logout)
+		authGrp.GET("/oidc/login", auth.OidcLogin)
+
+		authGrp.GET("/oidc/callback", auth.OidcCallback)
+
+		authGrp.POST("/refresh", auth.Refresh)
+
+		// Works with an expired access token, the refresh token cookie identifies the session.
+		// A POST so CsrfProtect keeps other sites from logging users out
+		authGrp.POST("/logout", auth.Logout)
+
+		authGrp.POST("/forgotPassword", auth.ForgotPassword)
+
+		authGrp.POST("/resetPassword", auth.ResetPassword)
+
+		authGrp.POST("/mfa/verify", auth.VerifyMfa)
+
+		authGrp.POST("/magic/send", auth.SendMagicLink)
+
+		authGrp.POST("/magic/verify", auth.VerifyMagicLink)
+
+		// Everything below needs a logged in browser session, access tokens can't manage the account
+		authGrp.Use(middleware.IsAuthenticated, middleware.RequireSession)
+
+		authGrp.GET("/user", auth.GetUserDetails)
+
+		authGrp.GET("/sessions", auth.GetSessions)
+
+		authGrp.DELETE("/sessions/:id", auth.RevokeSession)
+
+		authGrp.DELETE("/sessions", auth.RevokeAllSessions)
+
+		authGrp.POST("/mfa/enroll", auth.EnrollMfa)
+
+		authGrp.POST("/mfa/confirm", auth.ConfirmMfa)
 
-		authGrp.Use(middleware.IsAuthenticated).GET("/user", auth.GetUserDetails)
+		authGrp.POST("/mfa/disable", auth.DisableMfa)
 	}
 }
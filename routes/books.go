@@ -3,6 +3,7 @@ package routes
 import (
 	"example/aibooks-backend/controllers/books"
 	"example/aibooks-backend/middleware"
+	"example/aibooks-backend/models/accesstokens"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,15 +14,16 @@ func RegisterBookdataRoutes(r *gin.RouterGroup) {
 		booksGroup.GET("/searchSuggestions", books.SearchSuggestions)
 		booksGroup.GET("/search", books.GetAllBooks)
 		booksGroup.GET("/byId/:id", books.GetBookById)
+		booksGroup.GET("/byId/:id/pdf", middleware.IsAuthenticated, middleware.RequireScope(accesstokens.ScopeBooksRead), books.GetBookPdf)
 		booksGroup.GET("/latest", books.GetLatestBooks)
 		booksGroup.GET("/related/:id", books.GetRelatedBooks)
 	}
 
 	ratingsGroup := booksGroup.Group("/ratings")
 	{
-		ratingsGroup.GET("/:bookId", books.GetRatingsByBookId)
-		ratingsGroup.Use(middleware.IsAuthenticated).POST("/add", books.AddRating)
-		ratingsGroup.Use(middleware.IsAuthenticated).GET("/myRatingFor/:bookId", books.GetMyRatingForBookId)
-		ratingsGroup.Use(middleware.IsAuthenticated).DELETE("/delete/:ratingId", books.DeleteRatingById)
+		ratingsGroup.GET("/:bookId", middleware.OptionalAuthentication, books.GetRatingsByBookId)
+		ratingsGroup.POST("/add", middleware.IsAuthenticated, middleware.RequireScope(accesstokens.ScopeRatingsWrite), books.AddRating)
+		ratingsGroup.GET("/myRatingFor/:bookId", middleware.IsAuthenticated, middleware.RequireScope(accesstokens.ScopeBooksRead), books.GetMyRatingForBookId)
+		ratingsGroup.DELETE("/delete/:ratingId", middleware.IsAuthenticated, middleware.RequireScope(accesstokens.ScopeRatingsWrite), books.DeleteRatingById)
 	}
 }
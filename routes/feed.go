@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"example/aibooks-backend/controllers/feed"
+	"example/aibooks-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterFeedRoutes(r *gin.RouterGroup) {
+	feedGroup := r.Group("/feed")
+	feedGroup.Use(middleware.IsAuthenticated, middleware.RequireSession)
+	{
+		feedGroup.GET("/", feed.GetFeed)
+	}
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"example/aibooks-backend/controllers/files"
+	"example/aibooks-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterFileRoutes(r *gin.RouterGroup) {
+	filesGroup := r.Group("/files")
+	{
+		// Book PDFs need a signed in user, everything else is public
+		filesGroup.GET("/*key", middleware.AuthenticateIf(files.IsPrivateFile), files.GetFile)
+	}
+}
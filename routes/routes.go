@@ -1,15 +1,23 @@
 package routes
 
 import (
+	"example/aibooks-backend/middleware"
+
 	"github.com/gin-gonic/gin"
 )
 
 func RegisterRoutes(r *gin.Engine) {
 	apiRoutes := r.Group("/api/v1")
+	apiRoutes.Use(middleware.CsrfProtect)
 
 	RegisterUserRoutes(apiRoutes)
 	RegisterAuthRoutes(apiRoutes)
 	RegisterBookdataRoutes(apiRoutes)
 	RegisterStaticDataRoutes(apiRoutes)
 	RegisterLibraryRoutes(apiRoutes)
+	RegisterFeedRoutes(apiRoutes)
+	RegisterFileRoutes(apiRoutes)
+	RegisterAdminRoutes(apiRoutes)
+
+	RegisterWellKnownRoutes(r)
 }
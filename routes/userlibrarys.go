@@ -3,6 +3,7 @@ package routes
 import (
 	"example/aibooks-backend/controllers/userlibrarys"
 	"example/aibooks-backend/middleware"
+	"example/aibooks-backend/models/accesstokens"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,9 +12,10 @@ func RegisterLibraryRoutes(r *gin.RouterGroup) {
 	libraryGroup := r.Group("/myLibrary")
 	libraryGroup.Use(middleware.IsAuthenticated)
 	{
-		libraryGroup.GET("/getBooks", userlibrarys.GetMyLibrary)
-		libraryGroup.PUT("/addBook/:bookId", userlibrarys.AddBookToLibrary)
-		libraryGroup.DELETE("/removeBook/:bookId", userlibrarys.RemoveBookFromLibrary)
-		libraryGroup.GET("/isBookInLibrary/:bookId", userlibrarys.IsBookInLibrary)
+		libraryGroup.GET("/getBooks", middleware.RequireScope(accesstokens.ScopeLibraryRead), userlibrarys.GetMyLibrary)
+		libraryGroup.PUT("/addBook/:bookId", middleware.RequireScope(accesstokens.ScopeLibraryWrite), userlibrarys.AddBookToLibrary)
+		libraryGroup.PUT("/finishBook/:bookId", middleware.RequireScope(accesstokens.ScopeLibraryWrite), userlibrarys.MarkBookFinished)
+		libraryGroup.DELETE("/removeBook/:bookId", middleware.RequireScope(accesstokens.ScopeLibraryWrite), userlibrarys.RemoveBookFromLibrary)
+		libraryGroup.GET("/isBookInLibrary/:bookId", middleware.RequireScope(accesstokens.ScopeLibraryRead), userlibrarys.IsBookInLibrary)
 	}
 }
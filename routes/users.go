@@ -3,14 +3,69 @@ package routes
 import (
 	"example/aibooks-backend/controllers/users"
 	"example/aibooks-backend/middleware"
+	"example/aibooks-backend/models/accesstokens"
 
 	"github.com/gin-gonic/gin"
 )
 
 func RegisterUserRoutes(r *gin.RouterGroup) {
+	publicUsersGroup := r.Group("/users")
+	{
+		publicUsersGroup.GET("/:id/avatar", users.GetAvatar)
+		publicUsersGroup.GET("/:id/profile", middleware.OptionalAuthentication, users.GetProfile)
+		publicUsersGroup.GET("/:id/followers", middleware.OptionalAuthentication, users.GetFollowers)
+		publicUsersGroup.GET("/:id/following", middleware.OptionalAuthentication, users.GetFollowing)
+	}
+
 	usersGroup := r.Group("/users")
 	usersGroup.Use(middleware.IsAuthenticated)
 	{
-		usersGroup.GET("/", users.GetUser)
+		usersGroup.GET("/", middleware.RequireScope(accesstokens.ScopeProfileRead), users.GetUser)
+	}
+
+	accountGroup := usersGroup.Group("")
+	accountGroup.Use(middleware.RequireSession)
+	{
+		accountGroup.PATCH("/", users.UpdateProfile)
+		accountGroup.PUT("/avatar", users.UploadAvatar)
+		accountGroup.DELETE("/avatar", users.DeleteAvatar)
+		accountGroup.POST("/email/sendOtp", users.SendEmailChangeOtp)
+		accountGroup.POST("/email/verify", users.VerifyEmailChange)
+
+		accountGroup.DELETE("/", users.DeleteAccount)
+		accountGroup.POST("/delete/sendOtp", users.SendDeletionOtp)
+		accountGroup.POST("/delete/cancel", users.CancelAccountDeletion)
+
+		// Starting an export sends an email and does work, so it is a POST that CsrfProtect covers
+		accountGroup.POST("/export", users.ExportUserData)
+		accountGroup.GET("/export/:id", users.GetExportStatus)
+		accountGroup.GET("/export/:id/download", users.DownloadExport)
+
+		accountGroup.GET("/blocks", users.GetBlockedUsers)
+		accountGroup.GET("/mutes", users.GetMutedUsers)
+	}
+
+	followGroup := usersGroup.Group("/:id/follow")
+	followGroup.Use(middleware.RequireSession)
+	{
+		followGroup.POST("", users.FollowUser)
+		followGroup.DELETE("", users.UnfollowUser)
+	}
+
+	blockGroup := usersGroup.Group("/:id")
+	blockGroup.Use(middleware.RequireSession)
+	{
+		blockGroup.POST("/block", users.BlockUser)
+		blockGroup.DELETE("/block", users.UnblockUser)
+		blockGroup.POST("/mute", users.MuteUser)
+		blockGroup.DELETE("/mute", users.UnmuteUser)
+	}
+
+	tokensGroup := usersGroup.Group("/tokens")
+	tokensGroup.Use(middleware.RequireSession)
+	{
+		tokensGroup.GET("/", users.GetAccessTokens)
+		tokensGroup.POST("/", users.CreateAccessToken)
+		tokensGroup.DELETE("/:id", users.DeleteAccessToken)
 	}
 }
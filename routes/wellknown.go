@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"example/aibooks-backend/controllers/wellknown"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterWellKnownRoutes registers routes that live at fixed paths outside /api/v1.
+func RegisterWellKnownRoutes(r *gin.Engine) {
+	wellKnownGroup := r.Group("/.well-known")
+	{
+		wellKnownGroup.GET("/jwks.json", wellknown.GetJwks)
+	}
+}
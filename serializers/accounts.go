@@ -0,0 +1,87 @@
+package serializers
+
+import (
+	"example/aibooks-backend/models/accesstokens"
+	"example/aibooks-backend/models/dataexports"
+	"example/aibooks-backend/models/usersessions"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Session struct {
+	Id         primitive.ObjectID `json:"id"`
+	UserAgent  string             `json:"userAgent"`
+	Ip         string             `json:"ip"`
+	CreatedAt  primitive.DateTime `json:"createdAt"`
+	LastSeenAt primitive.DateTime `json:"lastSeenAt"`
+	Current    bool               `json:"current"`
+}
+
+func NewSessions(sessions []usersessions.UserSession, currentSessionId string) []Session {
+	response := make([]Session, len(sessions))
+	for i, session := range sessions {
+		response[i] = Session{
+			Id:         session.Id,
+			UserAgent:  session.UserAgent,
+			Ip:         session.Ip,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			Current:    session.Id.Hex() == currentSessionId,
+		}
+	}
+	return response
+}
+
+type AccessToken struct {
+	Id         primitive.ObjectID  `json:"id"`
+	Name       string              `json:"name"`
+	Scopes     []string            `json:"scopes"`
+	Prefix     string              `json:"prefix"`
+	ExpiresAt  *primitive.DateTime `json:"expiresAt,omitempty"`
+	LastUsedAt *primitive.DateTime `json:"lastUsedAt,omitempty"`
+	CreatedAt  primitive.DateTime  `json:"createdAt"`
+}
+
+func NewAccessToken(token accesstokens.AccessToken) AccessToken {
+	return AccessToken{
+		Id:         token.Id,
+		Name:       token.Name,
+		Scopes:     token.Scopes,
+		Prefix:     token.Prefix,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+func NewAccessTokens(tokens []accesstokens.AccessToken) []AccessToken {
+	response := make([]AccessToken, len(tokens))
+	for i, token := range tokens {
+		response[i] = NewAccessToken(token)
+	}
+	return response
+}
+
+type DataExport struct {
+	Id          primitive.ObjectID  `json:"id"`
+	Format      string              `json:"format"`
+	Status      string              `json:"status"`
+	FileName    string              `json:"fileName,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	CreatedAt   primitive.DateTime  `json:"createdAt"`
+	CompletedAt *primitive.DateTime `json:"completedAt,omitempty"`
+	ExpiresAt   primitive.DateTime  `json:"expiresAt"`
+}
+
+func NewDataExport(export dataexports.DataExport) DataExport {
+	return DataExport{
+		Id:          export.Id,
+		Format:      export.Format,
+		Status:      export.Status,
+		FileName:    export.FileName,
+		Error:       export.Error,
+		CreatedAt:   export.CreatedAt,
+		CompletedAt: export.CompletedAt,
+		ExpiresAt:   export.ExpiresAt,
+	}
+}
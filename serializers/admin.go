@@ -0,0 +1,71 @@
+package serializers
+
+import (
+	"example/aibooks-backend/models/emailoutbox"
+	"example/aibooks-backend/models/loginattempts"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Lockout struct {
+	Id            primitive.ObjectID `json:"id"`
+	Kind          string             `json:"kind"`
+	Key           string             `json:"key"`
+	Failures      int                `json:"failures"`
+	LockedUntil   primitive.DateTime `json:"lockedUntil"`
+	LastFailureAt primitive.DateTime `json:"lastFailureAt"`
+}
+
+func NewLockouts(lockouts []loginattempts.LoginAttempt) []Lockout {
+	response := make([]Lockout, len(lockouts))
+	for i, lockout := range lockouts {
+		response[i] = Lockout{
+			Id:            lockout.Id,
+			Kind:          lockout.Kind,
+			Key:           lockout.Key,
+			Failures:      lockout.Failures,
+			LockedUntil:   lockout.LockedUntil,
+			LastFailureAt: lockout.LastFailureAt,
+		}
+	}
+	return response
+}
+
+// OutboxEmail leaves out the message body, which may contain one time codes.
+type OutboxEmail struct {
+	Id            primitive.ObjectID  `json:"id"`
+	To            []string            `json:"to"`
+	Template      string              `json:"template"`
+	Subject       string              `json:"subject"`
+	Status        string              `json:"status"`
+	Attempts      int                 `json:"attempts"`
+	LastError     string              `json:"lastError,omitempty"`
+	NextAttemptAt primitive.DateTime  `json:"nextAttemptAt"`
+	SentAt        *primitive.DateTime `json:"sentAt,omitempty"`
+	CreatedAt     primitive.DateTime  `json:"createdAt"`
+	UpdatedAt     primitive.DateTime  `json:"updatedAt"`
+}
+
+func NewOutboxEmail(message emailoutbox.OutboxMessage) OutboxEmail {
+	return OutboxEmail{
+		Id:            message.Id,
+		To:            message.To,
+		Template:      message.Template,
+		Subject:       message.Subject,
+		Status:        message.Status,
+		Attempts:      message.Attempts,
+		LastError:     message.LastError,
+		NextAttemptAt: message.NextAttemptAt,
+		SentAt:        message.SentAt,
+		CreatedAt:     message.CreatedAt,
+		UpdatedAt:     message.UpdatedAt,
+	}
+}
+
+func NewOutboxEmails(messages []emailoutbox.OutboxMessage) []OutboxEmail {
+	response := make([]OutboxEmail, len(messages))
+	for i, message := range messages {
+		response[i] = NewOutboxEmail(message)
+	}
+	return response
+}
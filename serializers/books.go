@@ -0,0 +1,105 @@
+package serializers
+
+import (
+	"example/aibooks-backend/config/imageconfigs"
+	"example/aibooks-backend/models/books"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PublicBook is what readers see. The PDF's storage key and link stay out of it,
+// signed in readers fetch the PDF through GET /books/byId/:id/pdf.
+type PublicBook struct {
+	Id            primitive.ObjectID      `json:"id"`
+	Title         string                  `json:"title"`
+	Slug          string                  `json:"slug"`
+	Summary       string                  `json:"summary"`
+	TotalChapters int                     `json:"totalChapters"`
+	Genre         []string                `json:"genre"`
+	CoverImage    imageconfigs.CoverImage `json:"coverImage"`
+	CreatedAt     primitive.DateTime      `json:"createdAt"`
+	Rating        float64                 `json:"rating"`
+	TotalRatings  int                     `json:"totalRatings"`
+	HasPdf        bool                    `json:"hasPdf"`
+}
+
+// AdminBook adds where the PDF is stored, for the admin views.
+type AdminBook struct {
+	PublicBook
+	PdfUrl      string `json:"pdfUrl"`
+	PdfPublicId string `json:"pdfPublicId"`
+}
+
+type BookShort struct {
+	Id         primitive.ObjectID      `json:"id"`
+	Title      string                  `json:"title"`
+	Genre      []string                `json:"genre"`
+	CoverImage imageconfigs.CoverImage `json:"coverImage"`
+}
+
+// newCoverImage reports the stored dimensions of a processed cover, and the default
+// sizes for covers that were never processed.
+func newCoverImage(publicId string, url string, width *imageconfigs.ImageWidthHeight, height *imageconfigs.ImageWidthHeight, variants *imageconfigs.CoverVariants) imageconfigs.CoverImage {
+	coverImage := imageconfigs.CoverImage{
+		PublicId: publicId,
+		Url:      url,
+		Width:    imageconfigs.GetDefaultWidth(),
+		Height:   imageconfigs.GetDefaultHeight(),
+		Variants: variants,
+	}
+	if width != nil && height != nil {
+		coverImage.Width = *width
+		coverImage.Height = *height
+	}
+	return coverImage
+}
+
+func NewPublicBook(bookData books.BookData) PublicBook {
+	var rating float64
+	if bookData.TotalRatings != 0 {
+		rating = bookData.SumRatings / float64(bookData.TotalRatings)
+	}
+
+	return PublicBook{
+		Id:            bookData.Id,
+		Title:         bookData.Title,
+		Slug:          bookData.Slug,
+		Summary:       bookData.Summary,
+		TotalChapters: bookData.TotalChapters,
+		Genre:         bookData.Genre,
+		CoverImage:    newCoverImage(bookData.CoverImagePublicId, bookData.CoverImageUrl, bookData.CoverImageWidth, bookData.CoverImageHeight, bookData.CoverImageVariants),
+		CreatedAt:     bookData.CreatedAt,
+		Rating:        rating,
+		TotalRatings:  bookData.TotalRatings,
+		HasPdf:        bookData.PdfUrl != "" || bookData.PdfPublicId != "",
+	}
+}
+
+func NewPublicBooks(bookDatas []books.BookData) []PublicBook {
+	response := make([]PublicBook, len(bookDatas))
+	for i, bookData := range bookDatas {
+		response[i] = NewPublicBook(bookData)
+	}
+	return response
+}
+
+func NewAdminBook(bookData books.BookData) AdminBook {
+	return AdminBook{
+		PublicBook:  NewPublicBook(bookData),
+		PdfUrl:      bookData.PdfUrl,
+		PdfPublicId: bookData.PdfPublicId,
+	}
+}
+
+func NewBookShorts(bookDatas []books.BookDataShort) []BookShort {
+	response := make([]BookShort, len(bookDatas))
+	for i, bookData := range bookDatas {
+		response[i] = BookShort{
+			Id:         bookData.Id,
+			Title:      bookData.Title,
+			Genre:      bookData.Genre,
+			CoverImage: newCoverImage(bookData.CoverImagePublicId, bookData.CoverImageUrl, bookData.CoverImageWidth, bookData.CoverImageHeight, bookData.CoverImageVariants),
+		}
+	}
+	return response
+}
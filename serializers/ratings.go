@@ -0,0 +1,82 @@
+package serializers
+
+import (
+	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/models/users"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Rating struct {
+	Id        primitive.ObjectID `json:"id"`
+	UserId    primitive.ObjectID `json:"userId"`
+	BookId    primitive.ObjectID `json:"bookId"`
+	Rating    int                `json:"rating"`
+	Review    string             `json:"review"`
+	CreatedAt primitive.DateTime `json:"createdAt"`
+	UpdatedAt primitive.DateTime `json:"updatedAt"`
+}
+
+type RatingWithUser struct {
+	Rating
+	User PublicUser `json:"user"`
+}
+
+func NewRating(rating books.Rating) Rating {
+	return Rating{
+		Id:        rating.Id,
+		UserId:    rating.UserId,
+		BookId:    rating.BookId,
+		Rating:    rating.Rating,
+		Review:    rating.Review,
+		CreatedAt: rating.CreatedAt,
+		UpdatedAt: rating.UpdatedAt,
+	}
+}
+
+func NewRatingWithUser(rating books.RatingResponse) RatingWithUser {
+	return RatingWithUser{
+		Rating: Rating{
+			Id:        rating.Id,
+			UserId:    rating.UserId,
+			BookId:    rating.BookId,
+			Rating:    rating.Rating,
+			Review:    rating.Review,
+			CreatedAt: rating.CreatedAt,
+			UpdatedAt: rating.UpdatedAt,
+		},
+		User: NewPublicUser(users.Users{
+			Id:           rating.User.Id,
+			FirstName:    rating.User.FirstName,
+			LastName:     rating.User.LastName,
+			DisplayName:  rating.User.DisplayName,
+			AvatarFileId: rating.User.AvatarFileId,
+		}),
+	}
+}
+
+func NewRatingsWithUser(ratings []books.RatingResponse) []RatingWithUser {
+	response := make([]RatingWithUser, len(ratings))
+	for i, rating := range ratings {
+		response[i] = NewRatingWithUser(rating)
+	}
+	return response
+}
+
+type RatingWithBookTitle struct {
+	Id        primitive.ObjectID `json:"id"`
+	BookId    primitive.ObjectID `json:"bookId"`
+	BookTitle string             `json:"bookTitle"`
+	Rating    int                `json:"rating"`
+	Review    string             `json:"review"`
+	CreatedAt primitive.DateTime `json:"createdAt"`
+	UpdatedAt primitive.DateTime `json:"updatedAt"`
+}
+
+func NewRatingsWithBookTitle(ratings []books.RatingWithBookTitle) []RatingWithBookTitle {
+	response := make([]RatingWithBookTitle, len(ratings))
+	for i, rating := range ratings {
+		response[i] = RatingWithBookTitle(rating)
+	}
+	return response
+}
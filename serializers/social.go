@@ -0,0 +1,95 @@
+package serializers
+
+import (
+	"example/aibooks-backend/models/activities"
+	"example/aibooks-backend/models/blocks"
+	"example/aibooks-backend/models/follows"
+	"example/aibooks-backend/models/users"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type FeedItem struct {
+	Id        primitive.ObjectID `json:"id"`
+	Type      string             `json:"type"`
+	Actor     PublicUser         `json:"actor"`
+	Book      BookShort          `json:"book"`
+	Rating    int                `json:"rating,omitempty"`
+	Review    string             `json:"review,omitempty"`
+	CreatedAt primitive.DateTime `json:"createdAt"`
+}
+
+// NewFeedItems renders feed items with their actors, skipping items whose book or
+// actor no longer exists.
+func NewFeedItems(items []activities.FeedItem, actors map[primitive.ObjectID]users.Users) []FeedItem {
+	response := []FeedItem{}
+	for _, item := range items {
+		actor, ok := actors[item.ActorId]
+		if !ok || item.Book.Id.IsZero() {
+			continue
+		}
+
+		response = append(response, FeedItem{
+			Id:    item.Id,
+			Type:  item.Type,
+			Actor: NewPublicUser(actor),
+			Book: BookShort{
+				Id:         item.Book.Id,
+				Title:      item.Book.Title,
+				Genre:      item.Book.Genre,
+				CoverImage: newCoverImage(item.Book.CoverImagePublicId, item.Book.CoverImageUrl, item.Book.CoverImageWidth, item.Book.CoverImageHeight, item.Book.CoverImageVariants),
+			},
+			Rating:    item.Rating,
+			Review:    item.Review,
+			CreatedAt: item.CreatedAt,
+		})
+	}
+	return response
+}
+
+type FollowEntry struct {
+	PublicUser
+	FollowId   primitive.ObjectID `json:"followId"`
+	FollowedAt primitive.DateTime `json:"followedAt"`
+}
+
+// NewFollowEntries renders a follower or following list. userOf picks which side of
+// the follow to show.
+func NewFollowEntries(list []follows.Follow, people map[primitive.ObjectID]users.Users, userOf func(follows.Follow) primitive.ObjectID) []FollowEntry {
+	response := []FollowEntry{}
+	for _, follow := range list {
+		user, ok := people[userOf(follow)]
+		if !ok {
+			continue
+		}
+
+		response = append(response, FollowEntry{
+			PublicUser: NewPublicUser(user),
+			FollowId:   follow.Id,
+			FollowedAt: follow.CreatedAt,
+		})
+	}
+	return response
+}
+
+type BlockEntry struct {
+	PublicUser
+	CreatedAt primitive.DateTime `json:"createdAt"`
+}
+
+// NewBlockEntries renders a block or mute list. Entries for deleted users are skipped.
+func NewBlockEntries(list []blocks.Block, people map[primitive.ObjectID]users.Users) []BlockEntry {
+	response := []BlockEntry{}
+	for _, entry := range list {
+		user, ok := people[entry.TargetId]
+		if !ok {
+			continue
+		}
+
+		response = append(response, BlockEntry{
+			PublicUser: NewPublicUser(user),
+			CreatedAt:  entry.CreatedAt,
+		})
+	}
+	return response
+}
@@ -0,0 +1,131 @@
+package serializers
+
+import (
+	"example/aibooks-backend/models/books"
+	"example/aibooks-backend/models/users"
+	"example/aibooks-backend/utils"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Views of a user. Each view lists the fields it exposes instead of hiding fields of
+// users.Users, so a new sensitive field on the model is never sent by accident.
+
+// PublicUser is what any other user may see, e.g. next to a review.
+type PublicUser struct {
+	Id          primitive.ObjectID `json:"id"`
+	DisplayName string             `json:"display_name"`
+	AvatarUrl   string             `json:"avatar_url,omitempty"`
+}
+
+// SelfUser is what a user sees about their own account.
+type SelfUser struct {
+	Id                  primitive.ObjectID  `json:"id"`
+	Email               string              `json:"email"`
+	EmailVerified       bool                `json:"email_verified"`
+	FirstName           string              `json:"first_name"`
+	LastName            string              `json:"last_name"`
+	Roles               []string            `json:"roles"`
+	TotpEnabled         bool                `json:"totp_enabled"`
+	UpdatedAt           primitive.DateTime  `json:"updated_at"`
+	DeletionScheduledAt *primitive.DateTime `json:"deletion_scheduled_at,omitempty"`
+	DisplayName         string              `json:"display_name"`
+	Bio                 string              `json:"bio"`
+	AvatarUrl           string              `json:"avatar_url,omitempty"`
+	FavouriteGenres     []string            `json:"favourite_genres"`
+	Preferences         users.Preferences   `json:"preferences"`
+	Privacy             users.Privacy       `json:"privacy"`
+	PendingEmail        string              `json:"pending_email,omitempty"`
+}
+
+// AdminUser adds account security state useful for support.
+type AdminUser struct {
+	SelfUser
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	TotpEnrollmentPending  bool `json:"totp_enrollment_pending"`
+}
+
+// avatarUrl includes the file id so clients and caches pick up a new upload.
+func avatarUrl(userId primitive.ObjectID, fileId *primitive.ObjectID) string {
+	if fileId == nil {
+		return ""
+	}
+	return "/api/v1/users/" + userId.Hex() + "/avatar?v=" + fileId.Hex()
+}
+
+// publicName is the display name, or the first name and last initial for users who
+// have not set one, so full legal names are never shown to other users.
+func publicName(user users.Users) string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	if initial, _ := utf8.DecodeRuneInString(user.LastName); initial != utf8.RuneError {
+		return user.FirstName + " " + string(initial) + "."
+	}
+	return user.FirstName
+}
+
+func NewPublicUser(user users.Users) PublicUser {
+	return PublicUser{
+		Id:          user.Id,
+		DisplayName: publicName(user),
+		AvatarUrl:   avatarUrl(user.Id, user.AvatarFileId),
+	}
+}
+
+func NewSelfUser(user users.Users) SelfUser {
+	return SelfUser{
+		Id:                  user.Id,
+		Email:               user.Email,
+		EmailVerified:       user.EmailVerified,
+		FirstName:           user.FirstName,
+		LastName:            user.LastName,
+		Roles:               user.GetRoles(),
+		TotpEnabled:         user.TotpEnabled,
+		UpdatedAt:           user.UpdatedAt,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+		DisplayName:         user.DisplayName,
+		Bio:                 user.Bio,
+		AvatarUrl:           avatarUrl(user.Id, user.AvatarFileId),
+		FavouriteGenres:     utils.Ternary(user.FavouriteGenres == nil, []string{}, user.FavouriteGenres),
+		Preferences:         user.Preferences,
+		Privacy:             user.Privacy,
+		PendingEmail:        user.PendingEmail,
+	}
+}
+
+func NewAdminUser(user users.Users) AdminUser {
+	return AdminUser{
+		SelfUser:               NewSelfUser(user),
+		RecoveryCodesRemaining: len(user.RecoveryCodes),
+		TotpEnrollmentPending:  user.TotpPendingSecret != "",
+	}
+}
+
+// Profile is a user's public profile page. Sections the viewer may not see are nil
+// and left out of the response, while visible but empty sections are empty lists.
+type Profile struct {
+	PublicUser
+	Private         bool                   `json:"private"`
+	FollowerCount   int64                  `json:"follower_count"`
+	FollowingCount  int64                  `json:"following_count"`
+	IsFollowing     bool                   `json:"is_following"`
+	Bio             string                 `json:"bio,omitempty"`
+	FavouriteGenres []string               `json:"favourite_genres,omitempty"`
+	Stats           *books.RatingStats     `json:"stats,omitempty"`
+	RecentReviews   *[]RatingWithBookTitle `json:"recent_reviews,omitempty"`
+	Library         *[]PublicBook          `json:"library,omitempty"`
+}
+
+func NewProfile(user users.Users, viewerId primitive.ObjectID) Profile {
+	profile := Profile{
+		PublicUser: NewPublicUser(user),
+		Private:    !user.ProfileVisibleTo(viewerId),
+	}
+	if !profile.Private {
+		profile.Bio = user.Bio
+		profile.FavouriteGenres = user.FavouriteGenres
+	}
+	return profile
+}
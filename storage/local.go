@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalBlob keeps objects as files under Dir, for development and single-node setups.
+// The content type is derived from the key's extension.
+type LocalBlob struct {
+	Dir string
+}
+
+func NewLocalBlob(dir string) (*LocalBlob, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalBlob{Dir: dir}, nil
+}
+
+func (b *LocalBlob) path(key string) string {
+	return filepath.Join(b.Dir, filepath.FromSlash(key))
+}
+
+func (b *LocalBlob) Put(key string, r io.Reader, size int64, contentType string) error {
+	path := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write next to the target and rename so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (b *LocalBlob) Get(key string) (io.ReadCloser, string, error) {
+	f, err := os.Open(b.path(key))
+	if os.IsNotExist(err) {
+		return nil, "", ErrNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return f, contentType, nil
+}
+
+func (b *LocalBlob) Delete(key string) error {
+	if err := os.Remove(b.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *LocalBlob) DeletePrefix(prefix string) error {
+	// Prefixes ending in a slash are whole directories, anything else matches file names
+	if strings.HasSuffix(prefix, "/") {
+		return os.RemoveAll(b.path(strings.TrimSuffix(prefix, "/")))
+	}
+
+	matches, err := filepath.Glob(b.path(prefix) + "*")
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		if err := os.RemoveAll(match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
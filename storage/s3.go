@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Blob talks to any S3-compatible service (AWS, MinIO, R2...) with SigV4-signed
+// requests. PathStyle puts the bucket in the path instead of the host name, which
+// most self-hosted services need.
+type S3Blob struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyId     string
+	SecretAccessKey string
+	PathStyle       bool
+
+	client *http.Client
+}
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// NewS3BlobFromEnv reads S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY, S3_REGION
+// (default us-east-1), S3_ENDPOINT (default AWS) and S3_PATH_STYLE.
+func NewS3BlobFromEnv() (*S3Blob, error) {
+	b := &S3Blob{
+		Endpoint:        strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+		Region:          os.Getenv("S3_REGION"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyId:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+		client:          &http.Client{Timeout: 5 * time.Minute},
+	}
+	if b.Region == "" {
+		b.Region = "us-east-1"
+	}
+	if b.Endpoint == "" {
+		b.Endpoint = "https://s3." + b.Region + ".amazonaws.com"
+	}
+	if b.Bucket == "" || b.AccessKeyId == "" || b.SecretAccessKey == "" {
+		return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+	}
+	if _, err := url.Parse(b.Endpoint); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// awsEscape percent-encodes everything but the RFC 3986 unreserved characters, as
+// SigV4 canonical requests require.
+func awsEscape(s string, keepSlash bool) string {
+	var sb strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			sb.WriteByte(c)
+		case c == '/' && keepSlash:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func (b *S3Blob) newRequest(method string, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u, err := url.Parse(b.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/" + key
+	if b.PathStyle {
+		path = "/" + b.Bucket + path
+	} else {
+		u.Host = b.Bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = awsEscape(path, true)
+
+	var canonicalQuery []string
+	for name, values := range query {
+		for _, value := range values {
+			canonicalQuery = append(canonicalQuery, awsEscape(name, false)+"="+awsEscape(value, false))
+		}
+	}
+	sort.Strings(canonicalQuery)
+	u.RawQuery = strings.Join(canonicalQuery, "&")
+
+	return http.NewRequest(method, u.String(), body)
+}
+
+// sign adds a SigV4 Authorization header covering host and the x-amz headers.
+func (b *S3Blob) sign(req *http.Request, payloadHash string) {
+	b.signAt(req, payloadHash, time.Now().UTC())
+}
+
+func (b *S3Blob) signAt(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + b.Region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSha256([]byte("AWS4"+b.SecretAccessKey), date)
+	key = hmacSha256(key, b.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+b.AccessKeyId+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (b *S3Blob) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	b.sign(req, payloadHash)
+	return b.client.Do(req)
+}
+
+func s3Error(resp *http.Response, action string, key string) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s %s", action, key, resp.Status, strings.TrimSpace(string(body)))
+}
+
+func (b *S3Blob) Put(key string, r io.Reader, size int64, contentType string) error {
+	req, err := b.newRequest(http.MethodPut, key, nil, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	// The body is streamed, so it is not part of the signature
+	resp, err := b.do(req, "UNSIGNED-PAYLOAD")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp, "put", key)
+	}
+	return nil
+}
+
+func (b *S3Blob) Get(key string) (io.ReadCloser, string, error) {
+	req, err := b.newRequest(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := b.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.Header.Get("Content-Type"), nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, "", ErrNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, "", s3Error(resp, "get", key)
+	}
+}
+
+func (b *S3Blob) Delete(key string) error {
+	req, err := b.newRequest(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.do(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp, "delete", key)
+	}
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (b *S3Blob) DeletePrefix(prefix string) error {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		req, err := b.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := b.do(req, emptyPayloadHash)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return s3Error(resp, "list", prefix)
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, object := range result.Contents {
+			if err := b.Delete(object.Key); err != nil {
+				return err
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Blob stores opaque objects under slash-separated keys such as
+// "books/<id>/pdf-<id>.pdf". Drivers only differ in where the bytes live.
+type Blob interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get returns the object and its content type. The caller closes the reader.
+	Get(key string) (io.ReadCloser, string, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(key string) error
+	// DeletePrefix removes every object whose key starts with prefix.
+	DeletePrefix(prefix string) error
+}
+
+// PrivatePrefix marks keys that are kept in the private store. STORAGE_PUBLIC_URL only
+// exposes the public one, private objects are only served through the API.
+const PrivatePrefix = "private/"
+
+var defaultBlob Blob
+var privateBlob Blob
+var publicBaseUrl string
+var apiBaseUrl string
+
+var ErrNotLoaded = errors.New("blob storage not loaded")
+var ErrNotFound = errors.New("blob not found")
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Load picks the driver from STORAGE_DRIVER: local (default) or s3. Objects are
+// linked through STORAGE_PUBLIC_URL when set, otherwise through the API's /files route.
+// Private objects go to a second directory or bucket of the same driver.
+func Load() error {
+	driver := os.Getenv("STORAGE_DRIVER")
+	blob, err := NewBlob(driver)
+	if err != nil {
+		return err
+	}
+	private, err := NewPrivateBlob(driver)
+	if err != nil {
+		return err
+	}
+	defaultBlob = blob
+	privateBlob = private
+
+	backendUrl := os.Getenv("BACKEND_DEV_URL")
+	if os.Getenv("ENV") == "PROD" {
+		backendUrl = os.Getenv("BACKEND_PROD_URL")
+	}
+	apiBaseUrl = backendUrl + "/api/v1/files"
+
+	publicBaseUrl = strings.TrimRight(os.Getenv("STORAGE_PUBLIC_URL"), "/")
+	if publicBaseUrl == "" {
+		publicBaseUrl = apiBaseUrl
+	}
+	return nil
+}
+
+func NewBlob(driver string) (Blob, error) {
+	switch driver {
+	case "", "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "tmp/storage"
+		}
+		return NewLocalBlob(dir)
+	case "s3":
+		return NewS3BlobFromEnv()
+	default:
+		return nil, errors.New("unknown STORAGE_DRIVER " + driver)
+	}
+}
+
+// NewPrivateBlob opens the store for keys under PrivatePrefix, STORAGE_LOCAL_PRIVATE_DIR
+// or S3_PRIVATE_BUCKET. It has to be separate from the public store, otherwise
+// STORAGE_PUBLIC_URL would reach it too.
+func NewPrivateBlob(driver string) (Blob, error) {
+	switch driver {
+	case "", "local":
+		publicDir := os.Getenv("STORAGE_LOCAL_DIR")
+		if publicDir == "" {
+			publicDir = "tmp/storage"
+		}
+		dir := os.Getenv("STORAGE_LOCAL_PRIVATE_DIR")
+		if dir == "" {
+			dir = "tmp/storage-private"
+		}
+		if rel, err := filepath.Rel(publicDir, dir); err != nil || rel == "." || !strings.HasPrefix(rel, "..") {
+			return nil, errors.New("STORAGE_LOCAL_PRIVATE_DIR must be outside STORAGE_LOCAL_DIR")
+		}
+		return NewLocalBlob(dir)
+	case "s3":
+		blob, err := NewS3BlobFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		blob.Bucket = os.Getenv("S3_PRIVATE_BUCKET")
+		if blob.Bucket == "" || blob.Bucket == os.Getenv("S3_BUCKET") {
+			return nil, errors.New("S3_PRIVATE_BUCKET is required and must differ from S3_BUCKET")
+		}
+		return blob, nil
+	default:
+		return nil, errors.New("unknown STORAGE_DRIVER " + driver)
+	}
+}
+
+// IsPrivate reports whether key belongs in the private store.
+func IsPrivate(key string) bool {
+	return strings.HasPrefix(key, PrivatePrefix)
+}
+
+func blobFor(key string) Blob {
+	if IsPrivate(key) {
+		return privateBlob
+	}
+	return defaultBlob
+}
+
+// validKey rejects keys that could escape the bucket or directory.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func Put(key string, r io.Reader, size int64, contentType string) error {
+	if defaultBlob == nil {
+		return ErrNotLoaded
+	}
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	return blobFor(key).Put(key, r, size, contentType)
+}
+
+func Get(key string) (io.ReadCloser, string, error) {
+	if defaultBlob == nil {
+		return nil, "", ErrNotLoaded
+	}
+	if !validKey(key) {
+		return nil, "", ErrInvalidKey
+	}
+	return blobFor(key).Get(key)
+}
+
+func Delete(key string) error {
+	if defaultBlob == nil {
+		return ErrNotLoaded
+	}
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	return blobFor(key).Delete(key)
+}
+
+func DeletePrefix(prefix string) error {
+	if defaultBlob == nil {
+		return ErrNotLoaded
+	}
+	if !validKey(strings.TrimSuffix(prefix, "/")) {
+		return ErrInvalidKey
+	}
+	return blobFor(prefix).DeletePrefix(prefix)
+}
+
+// Url returns the public link of an object. Private objects are linked through the API.
+func Url(key string) string {
+	if IsPrivate(key) {
+		return ApiUrl(key)
+	}
+	return publicBaseUrl + "/" + key
+}
+
+// ApiUrl links an object through the API's /files route even when STORAGE_PUBLIC_URL
+// is set, for objects the API only hands out after checking the request.
+func ApiUrl(key string) string {
+	return apiBaseUrl + "/" + key
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewPrivateBlobLocalDir(t *testing.T) {
+	root := t.TempDir()
+	public := filepath.Join(root, "public")
+
+	tests := []struct {
+		name    string
+		private string
+		wantErr bool
+	}{
+		{"sibling directory", filepath.Join(root, "private"), false},
+		{"same directory", public, true},
+		{"inside the public directory", filepath.Join(public, "private"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STORAGE_LOCAL_DIR", public)
+			t.Setenv("STORAGE_LOCAL_PRIVATE_DIR", tt.private)
+
+			_, err := NewPrivateBlob("local")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPrivateBlob error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewPrivateBlobS3Bucket(t *testing.T) {
+	t.Setenv("S3_BUCKET", "books")
+	t.Setenv("S3_ACCESS_KEY_ID", "key")
+	t.Setenv("S3_SECRET_ACCESS_KEY", "secret")
+
+	for _, bucket := range []string{"", "books"} {
+		t.Setenv("S3_PRIVATE_BUCKET", bucket)
+		if _, err := NewPrivateBlob("s3"); err == nil {
+			t.Errorf("NewPrivateBlob with S3_PRIVATE_BUCKET %q succeeded", bucket)
+		}
+	}
+
+	t.Setenv("S3_PRIVATE_BUCKET", "books-private")
+	blob, err := NewPrivateBlob("s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket := blob.(*S3Blob).Bucket; bucket != "books-private" {
+		t.Errorf("bucket = %q, want books-private", bucket)
+	}
+}
+
+func TestPrivateKeysStayOffThePublicUrl(t *testing.T) {
+	publicBaseUrl, apiBaseUrl = "https://cdn.example.com", "https://api.example.com/api/v1/files"
+	defer func() { publicBaseUrl, apiBaseUrl = "", "" }()
+
+	if got := Url("books/1/cover-a-large.jpg"); got != "https://cdn.example.com/books/1/cover-a-large.jpg" {
+		t.Errorf("Url of a public key = %q", got)
+	}
+	if got := Url("private/books/1/pdf-a.pdf"); got != "https://api.example.com/api/v1/files/private/books/1/pdf-a.pdf" {
+		t.Errorf("Url of a private key = %q", got)
+	}
+}
+
+func TestPrivateKeysUseThePrivateBlob(t *testing.T) {
+	public, err := NewLocalBlob(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := NewLocalBlob(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultBlob, privateBlob = public, private
+	defer func() { defaultBlob, privateBlob = nil, nil }()
+
+	if err := Put("private/books/1/pdf-a.pdf", strings.NewReader("pdf"), 3, "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := public.Get("private/books/1/pdf-a.pdf"); err != ErrNotFound {
+		t.Errorf("public store Get = %v, want ErrNotFound", err)
+	}
+	reader, _, err := Get("private/books/1/pdf-a.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+
+	if err := DeletePrefix("private/books/1/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := private.Get("private/books/1/pdf-a.pdf"); err != ErrNotFound {
+		t.Errorf("private store Get after DeletePrefix = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// The SHA1 secret of RFC 6238 Appendix B, "12345678901234567890" in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The Appendix B codes have eight digits, a six digit code is their last six.
+func TestTotpCodeMatchesRfc6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	key := []byte("12345678901234567890")
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.code {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateTotp(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOk   bool
+	}{
+		{"current step", rfc6238Secret, totpCode(key, current), current, true},
+		{"previous step", rfc6238Secret, totpCode(key, current-1), current - 1, true},
+		{"next step", rfc6238Secret, totpCode(key, current+1), current + 1, true},
+		{"two steps back", rfc6238Secret, totpCode(key, current-2), 0, false},
+		{"two steps ahead", rfc6238Secret, totpCode(key, current+2), 0, false},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", totpCode(key, current), current, true},
+		{"surrounding spaces", rfc6238Secret, " " + totpCode(key, current) + " ", current, true},
+		{"wrong code", rfc6238Secret, "000000", 0, false},
+		{"empty code", rfc6238Secret, "", 0, false},
+		{"invalid secret", "not base32!", totpCode(key, current), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTotp(tt.secret, tt.code, now)
+			if ok != tt.wantOk || step != tt.wantStep {
+				t.Errorf("ValidateTotp = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOk)
+			}
+		})
+	}
+}
@@ -1,9 +1,9 @@
 package utils
 
 import (
+	"example/aibooks-backend/email"
 	"example/aibooks-backend/errorHandling"
-	"net/smtp"
-	"os"
+	"example/aibooks-backend/models/emailoutbox"
 )
 
 func Ternary[T any](condition bool, trueValue T, falseValue T) T {
@@ -13,27 +13,73 @@ func Ternary[T any](condition bool, trueValue T, falseValue T) T {
 	return falseValue
 }
 
-func sendEmail(recipient, subject, body string) error {
-	sender := os.Getenv("EMAIL")
-	password := os.Getenv("EMAIL_PASSWORD")
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-
-	message := []byte("Subject: " + subject + "\n\n" + body)
-
-	auth := smtp.PlainAuth("", sender, password, smtpHost)
-
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, sender, []string{recipient}, message)
+// sendEmail renders the template and queues it in the outbox; delivery happens in
+// the outbox worker so a slow mail server never blocks a request.
+func sendEmail(recipient string, template string, data map[string]string) error {
+	msg, err := email.Render(template, data)
 	if err != nil {
 		return errorHandling.NewAPIError(500, sendEmail, err.Error())
 	}
+	msg.To = []string{recipient}
+
+	if _, err := emailoutbox.Enqueue(template, data, msg); err != nil {
+		return errorHandling.NewAPIError(500, sendEmail, err.Error())
+	}
 	return nil
 }
 
 func SendOtpEmail(recipient, opt string) error {
-	err := sendEmail(recipient, "OTP", "Your OTP is "+opt)
+	err := sendEmail(recipient, "otp", map[string]string{"Code": opt})
 	if err == nil {
 		return nil
 	}
 	return errorHandling.NewAPIError(500, SendOtpEmail, err.Error())
 }
+
+func SendPasswordResetOtpEmail(recipient, otp string) error {
+	err := sendEmail(recipient, "password_reset", map[string]string{"Code": otp})
+	if err == nil {
+		return nil
+	}
+	return errorHandling.NewAPIError(500, SendPasswordResetOtpEmail, err.Error())
+}
+
+func SendMagicLinkEmail(recipient, link string) error {
+	err := sendEmail(recipient, "magic_link", map[string]string{"Link": link})
+	if err == nil {
+		return nil
+	}
+	return errorHandling.NewAPIError(500, SendMagicLinkEmail, err.Error())
+}
+
+func SendAccountDeletionOtpEmail(recipient, otp string) error {
+	err := sendEmail(recipient, "account_deletion", map[string]string{"Code": otp})
+	if err == nil {
+		return nil
+	}
+	return errorHandling.NewAPIError(500, SendAccountDeletionOtpEmail, err.Error())
+}
+
+func SendDataExportReadyEmail(recipient, link string) error {
+	err := sendEmail(recipient, "data_export_ready", map[string]string{"Link": link})
+	if err == nil {
+		return nil
+	}
+	return errorHandling.NewAPIError(500, SendDataExportReadyEmail, err.Error())
+}
+
+func SendEmailChangeOtpEmail(recipient, otp string) error {
+	err := sendEmail(recipient, "email_change", map[string]string{"Code": otp})
+	if err == nil {
+		return nil
+	}
+	return errorHandling.NewAPIError(500, SendEmailChangeOtpEmail, err.Error())
+}
+
+func SendEmailChangedEmail(recipient, newEmail string) error {
+	err := sendEmail(recipient, "email_changed", map[string]string{"NewEmail": newEmail})
+	if err == nil {
+		return nil
+	}
+	return errorHandling.NewAPIError(500, SendEmailChangedEmail, err.Error())
+}